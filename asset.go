@@ -0,0 +1,118 @@
+package gathertool
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// AssetStore 按内容hash保存下载的文件, 相同内容只保存一份
+// 文件保存在 Dir/hash前两位/hash.扩展名, url 与 hash 的对应关系记录在 Dir/index.txt
+type AssetStore struct {
+	Dir string
+
+	mux   sync.Mutex
+	urls  map[string]string // url -> hash
+	files map[string]string // hash -> 文件路径
+	index *os.File
+}
+
+// NewAssetStore 新建或打开文件存储目录
+func NewAssetStore(dir string) (*AssetStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	a := &AssetStore{
+		Dir:   dir,
+		urls:  make(map[string]string),
+		files: make(map[string]string),
+	}
+	index, err := os.OpenFile(filepath.Join(dir, "index.txt"), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	// 每行为 url \t hash \t 文件路径
+	scanner := bufio.NewScanner(index)
+	for scanner.Scan() {
+		v := strings.Split(scanner.Text(), "\t")
+		if len(v) != 3 {
+			continue
+		}
+		a.urls[v[0]] = v[1]
+		a.files[v[1]] = v[2]
+	}
+	if err := scanner.Err(); err != nil {
+		index.Close()
+		return nil, err
+	}
+	a.index = index
+	return a, nil
+}
+
+// Save 保存文件, 返回文件路径与是否为新的内容
+func (a *AssetStore) Save(rawUrl string, data []byte) (string, bool) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	p, ok := a.files[hash]
+	isNew := !ok
+	if isNew {
+		p = filepath.Join(a.Dir, hash[:2], hash+assetExt(rawUrl))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			loger(err)
+			return "", false
+		}
+		if err := ioutil.WriteFile(p, data, 0644); err != nil {
+			loger(err)
+			return "", false
+		}
+		a.files[hash] = p
+	}
+	if a.urls[rawUrl] != hash {
+		a.urls[rawUrl] = hash
+		if _, err := fmt.Fprintf(a.index, "%s\t%s\t%s\n", rawUrl, hash, p); err != nil {
+			loger(err)
+		}
+	}
+	return p, isNew
+}
+
+// Path 获取url对应的文件路径
+func (a *AssetStore) Path(rawUrl string) (string, bool) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	hash, ok := a.urls[rawUrl]
+	if !ok {
+		return "", false
+	}
+	return a.files[hash], true
+}
+
+// Close 关闭记录文件
+func (a *AssetStore) Close() error {
+	return a.index.Close()
+}
+
+// assetExt url中文件的扩展名
+func assetExt(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	ext := path.Ext(u.Path)
+	if len(ext) > 10 || strings.ContainsAny(ext, "\t\n") {
+		return ""
+	}
+	return ext
+}
@@ -0,0 +1,49 @@
+package gathertool
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAssetStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewAssetStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := []byte("\x89PNG same image")
+	p1, new1 := store.Save("http://a.com/1.png", img)
+	p2, new2 := store.Save("http://b.com/logo.png?v=2", img)
+	if !new1 || new2 || p1 != p2 {
+		t.Fatalf("p1 = %s %v, p2 = %s %v", p1, new1, p2, new2)
+	}
+	if _, isNew := store.Save("http://a.com/2.png", []byte("other")); !isNew {
+		t.Fatal("different content should be new")
+	}
+	_ = store.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*", "*.png"))
+	if len(files) != 2 {
+		t.Fatalf("files = %v", files)
+	}
+
+	// 重新打开后保留 url 与文件的对应关系
+	store, err = NewAssetStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if p, ok := store.Path("http://b.com/logo.png?v=2"); !ok || p != p1 {
+		t.Fatalf("Path = %s", p)
+	}
+	if _, isNew := store.Save("http://c.com/x.png", img); isNew {
+		t.Fatal("content saved before reopen should not be new")
+	}
+}
@@ -0,0 +1,79 @@
+package gathertool
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// XmlNode 通用的xml节点, Context.Auto 解析xml的结果
+type XmlNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content string     `xml:",chardata"`
+	Nodes   []*XmlNode `xml:",any"`
+}
+
+// ContentType 响应的 Content-Type, 不含参数 如 "text/html"
+// 响应头没有 Content-Type 或为 application/octet-stream 时返回根据 body 嗅探的类型
+func (c *Context) ContentType() string {
+	if c.Resp == nil {
+		return ""
+	}
+	t, _, err := mime.ParseMediaType(c.Resp.Header.Get("Content-Type"))
+	if (err != nil || t == "application/octet-stream") && c.SniffedType != "" {
+		t, _, err = mime.ParseMediaType(c.SniffedType)
+	}
+	if err != nil {
+		return ""
+	}
+	return t
+}
+
+// sniff 响应头没有 Content-Type 或为 application/octet-stream 时根据 body 的前512字节嗅探类型
+func (c *Context) sniff() {
+	c.SniffedType = ""
+	if c.Resp == nil || len(c.RespBody) == 0 {
+		return
+	}
+	t := c.Resp.Header.Get("Content-Type")
+	if t != "" && !strings.HasPrefix(t, "application/octet-stream") {
+		return
+	}
+	c.SniffedType = http.DetectContentType(c.RespBody)
+}
+
+// Auto 根据响应的 Content-Type 自动解析 RespBody
+// application/json, *+json         -> map[string]interface{} (数组则为 []interface{}, 数字为 json.Number)
+// text/html, application/xhtml+xml -> *goquery.Document
+// application/xml, text/xml, *+xml -> *XmlNode
+// text/*                           -> string
+// 其他                              -> []byte
+func (c *Context) Auto() (interface{}, error) {
+	if c.Resp == nil {
+		return nil, errors.New("Response is nil")
+	}
+	t := c.ContentType()
+	switch {
+	case t == "application/json" || strings.HasSuffix(t, "+json"):
+		var v interface{}
+		if err := jsonUnmarshal(c.RespBody, &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	case t == "text/html" || t == "application/xhtml+xml":
+		return NewGoquery(string(c.RespBody))
+	case t == "application/xml" || t == "text/xml" || strings.HasSuffix(t, "+xml"):
+		node := &XmlNode{}
+		if err := xml.NewDecoder(bytes.NewReader(c.RespBody)).Decode(node); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case strings.HasPrefix(t, "text/"):
+		return string(c.RespBody), nil
+	}
+	return c.RespBody, nil
+}
@@ -0,0 +1,76 @@
+package gathertool
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestAuto(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			fmt.Fprint(w, `{"name":"gathertool"}`)
+		case "/html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, `<html><title>gathertool</title></html>`)
+		case "/xml":
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<root id="1"><name>gathertool</name></root>`)
+		}
+	}))
+	defer ts.Close()
+
+	auto := func(path string) interface{} {
+		c, err := Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Do()
+		v, err := c.Auto()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	if m, ok := auto("/json").(map[string]interface{}); !ok || m["name"] != "gathertool" {
+		t.Fatalf("json = %v", m)
+	}
+	if doc, ok := auto("/html").(*goquery.Document); !ok || doc.Find("title").Text() != "gathertool" {
+		t.Fatal("html is not *goquery.Document")
+	}
+	node, ok := auto("/xml").(*XmlNode)
+	if !ok || node.XMLName.Local != "root" || len(node.Nodes) != 1 || node.Nodes[0].Content != "gathertool" {
+		t.Fatalf("xml = %+v", node)
+	}
+}
+
+func TestSniffContentType(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 阻止 net/http 自动设置 Content-Type
+		w.Header()["Content-Type"] = nil
+		fmt.Fprint(w, `<!DOCTYPE html><html><title>sniff</title></html>`)
+	}))
+	defer ts.Close()
+
+	c, err := Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if c.Resp.Header.Get("Content-Type") != "" {
+		t.Fatal("server sent Content-Type")
+	}
+	if c.SniffedType != "text/html; charset=utf-8" || c.ContentType() != "text/html" {
+		t.Fatalf("SniffedType = %q", c.SniffedType)
+	}
+	v, err := c.Auto()
+	if doc, ok := v.(*goquery.Document); err != nil || !ok || doc.Find("title").Text() != "sniff" {
+		t.Fatalf("Auto = %T, %v", v, err)
+	}
+}
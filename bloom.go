@@ -0,0 +1,59 @@
+package gathertool
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// bloomFilter 布隆过滤器, 内存大小固定, 判断存在时有一定的误判率
+type bloomFilter struct {
+	bits []uint64
+	m    uint64 // 位数
+	k    uint64 // hash 函数个数
+}
+
+// newBloomFilter n 为预计的元素个数, p 为误判率
+func newBloomFilter(n int, p float64) *bloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	if p <= 0 || p >= 1 {
+		p = 0.01
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+// hash 双重hash
+func (b *bloomFilter) hash(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	h1 := h.Sum64()
+	h2 := h1>>33 | h1<<31
+	return h1, h2 | 1
+}
+
+// TestAndAdd 添加key, 返回添加前是否(可能)已存在
+func (b *bloomFilter) TestAndAdd(key string) bool {
+	h1, h2 := b.hash(key)
+	exist := true
+	for i := uint64(0); i < b.k; i++ {
+		n := (h1 + i*h2) % b.m
+		if b.bits[n/64]&(1<<(n%64)) == 0 {
+			exist = false
+			b.bits[n/64] |= 1 << (n % 64)
+		}
+	}
+	return exist
+}
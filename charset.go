@@ -0,0 +1,37 @@
+package gathertool
+
+import (
+	"bytes"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// DetectBOM 根据内容开头的BOM判断编码, 返回编码与需要去除的BOM长度
+// 支持 UTF-8, UTF-16LE, UTF-16BE; 没有BOM返回 nil, 0
+func DetectBOM(b []byte) (encoding.Encoding, int) {
+	switch {
+	case bytes.HasPrefix(b, bomUTF8):
+		return unicode.UTF8, len(bomUTF8)
+	case bytes.HasPrefix(b, bomUTF16LE):
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), len(bomUTF16LE)
+	case bytes.HasPrefix(b, bomUTF16BE):
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), len(bomUTF16BE)
+	}
+	return nil, 0
+}
+
+// DecodeBOM 根据BOM将内容转为去除BOM的utf-8, 没有BOM原样返回
+func DecodeBOM(b []byte) ([]byte, error) {
+	enc, n := DetectBOM(b)
+	if enc == nil {
+		return b, nil
+	}
+	return enc.NewDecoder().Bytes(b[n:])
+}
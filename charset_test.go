@@ -0,0 +1,36 @@
+package gathertool
+
+import (
+	"testing"
+
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestDetectBOM(t *testing.T) {
+	cases := []struct {
+		name string
+		in   []byte
+		n    int
+	}{
+		{"utf-8", []byte("\xEF\xBB\xBF中文abc"), 3},
+		{"utf-16le", []byte{0xFF, 0xFE, 0x2D, 0x4E, 0x87, 0x65, 'a', 0, 'b', 0, 'c', 0}, 2},
+		{"utf-16be", []byte{0xFE, 0xFF, 0x4E, 0x2D, 0x65, 0x87, 0, 'a', 0, 'b', 0, 'c'}, 2},
+	}
+	for _, c := range cases {
+		enc, n := DetectBOM(c.in)
+		if enc == nil || n != c.n {
+			t.Fatalf("%s: enc = %v, n = %d", c.name, enc, n)
+		}
+		out, err := DecodeBOM(c.in)
+		if err != nil || string(out) != "中文abc" {
+			t.Fatalf("%s: out = %q, err = %v", c.name, out, err)
+		}
+	}
+
+	if enc, _ := DetectBOM([]byte("\xEF\xBB\xBFa")); enc != unicode.UTF8 {
+		t.Fatal("utf-8 bom is not unicode.UTF8")
+	}
+	if enc, n := DetectBOM([]byte("abc")); enc != nil || n != 0 {
+		t.Fatalf("no bom: enc = %v, n = %d", enc, n)
+	}
+}
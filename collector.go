@@ -0,0 +1,37 @@
+package gathertool
+
+import (
+	"sync"
+)
+
+// Collector 并发安全的结果收集, 用于在并发任务的回调中汇总数据
+type Collector struct {
+	mux   sync.Mutex
+	items []interface{}
+}
+
+// NewCollector 新建结果收集
+func NewCollector() *Collector {
+	return &Collector{items: make([]interface{}, 0)}
+}
+
+// Append 添加结果
+func (c *Collector) Append(items ...interface{}) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.items = append(c.items, items...)
+}
+
+// Items 获取所有结果的副本
+func (c *Collector) Items() []interface{} {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return append([]interface{}{}, c.items...)
+}
+
+// Len 结果数量
+func (c *Collector) Len() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return len(c.items)
+}
@@ -0,0 +1,43 @@
+package gathertool
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestCollector(t *testing.T) {
+	collector := NewCollector()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				collector.Append(i*100 + j)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if collector.Len() != 5000 || len(collector.Items()) != 5000 {
+		t.Fatalf("Len = %d", collector.Len())
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer ts.Close()
+	queue := NewQueue()
+	for i := 0; i < 20; i++ {
+		_ = queue.Add(&Task{Url: fmt.Sprintf("%s/%d", ts.URL, i)})
+	}
+	results := NewCollector()
+	StartJobGet(5, queue, SucceedFunc(func(c *Context) {
+		results.Append(string(c.RespBody))
+	}))
+	if results.Len() != 20 {
+		t.Fatalf("results = %d", results.Len())
+	}
+}
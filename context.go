@@ -8,16 +8,25 @@
 package gathertool
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"math"
 	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -39,6 +48,23 @@ type RetryFunc func(c *Context)
 // 请求结束后的方法类型
 type EndFunc func(c *Context)
 
+// 每次重试发送请求前的方法类型, 用于改变请求(如去掉触发拦截的header、换成手机端UA)
+// attempt 为第几次重试, 从1开始
+type FallbackFunc func(c *Context, attempt int)
+
+// 状态码对应 "file" 事件的方法类型, 执行时响应已读取到 RespBody, 用于将响应保存到文件
+type FileFunc func(c *Context)
+
+// 每次发送请求前(包括重试)对请求设置的方法类型
+type ReqFunc func(req *http.Request)
+
+// 创建请求时对 Context 设置的方法类型
+type ContextFunc func(c *Context)
+
+// 创建请求时对 Client 设置的方法类型
+// 作用于 Client 与 Transport 的副本, 不影响使用方传入的 Client; 每个请求复制一次, 多次请求时用 NewClient
+type ClientFunc func(client *http.Client) error
+
 
 // 请求上下文
 type Context struct {
@@ -66,6 +92,9 @@ type Context struct {
 	// 最大允许重试次数
 	MaxTimes RetryTimes
 
+	// 是否允许非幂等的请求(POST/PATCH)自动重试, 默认不允许
+	RetryNonIdempotent bool
+
 	// 请求成功了需要处理的事件
 	SucceedFunc SucceedFunc
 
@@ -75,12 +104,21 @@ type Context struct {
 	// 请求状态码设置了重试，在重试前的事件
 	RetryFunc RetryFunc
 
+	// 每次重试发送请求前的方法
+	FallbackFunc FallbackFunc
+
 	// 请求开始前的方法
 	StartFunc StartFunc
 
 	// 请求完成后的方法
 	EndFunc EndFunc
 
+	// 状态码对应 "file" 事件的方法
+	FileFunc FileFunc
+
+	// 指定状态码的方法, 见 OnStatus
+	statusFuncs map[int]func(c *Context)
+
 	// 本次请求的任务
 	// 用于有步骤的请求和并发执行请求
 	Task *Task
@@ -88,14 +126,106 @@ type Context struct {
 	// 请求返回的结果
 	RespBody []byte
 
+	// 请求ID, 用于关联分布式抓取中同一个请求的日志, 见 WithRequestID
+	RequestID string
+
 	// job编号
 	// 在执行多并发执行抓取任务，每个并发都有一个编号
 	// 这个编号是递增分配的
 	JobNumber int
 
-	// 请求的响应时间 单位ms
+	// 请求的响应时间 单位ms, 成功的请求包含读取body的时间
 	Ms time.Duration
 
+	// 首字节时间, 从发送请求到收到响应的第一个字节
+	TTFB time.Duration
+
+	// 请求各阶段的时间, 连接复用时 DNS、Connect、TLS 为0
+	Timing Timing
+
+	// 本次请求开始的时间
+	reqStart time.Time
+
+	// httptrace 的回调可能在多个goroutine执行(如同时尝试ipv4与ipv6)
+	timingMux sync.Mutex
+
+	// 是否已设置 httptrace
+	traced bool
+
+	// 设置 httptrace 之前请求的 context, ReplayWith 复制请求时使用, 不带当前 Context 的 httptrace
+	reqCtx context.Context
+
+	// 请求统计
+	stats *Stats
+
+	// 本次请求是否成功(执行了成功事件), 用于统计完成的请求
+	succeeded bool
+
+	// 被中止的重定向到其他host的地址, 见 SameHostRedirectsOnly
+	OffHostLocation string
+
+	// 循环重定向的地址, 见 ErrRedirectLoop
+	RedirectLoop []string
+
+	// 最后一次请求经过的每一跳的请求与响应, 见 Transactions
+	transactions []Transaction
+
+	// 响应设置的cookie(Set-Cookie), 每次请求后更新, 重试时为最后一次响应的cookie
+	RespCookies []*http.Cookie
+
+	// 响应头没有 Content-Type 时根据 body 嗅探的类型, 如 "text/html; charset=utf-8"
+	SniffedType string
+
+	// 下载的结果, Upload 完成后设置
+	DownloadStat *DownloadStat
+
+	// 下载时不输出进度日志
+	silentDownload bool
+
+	// 下载限速, 每秒字节数, 0 不限速
+	bandwidth int64
+
+	// 下载的缓冲大小, 0 为默认的 100KB
+	bufferSize int
+
+	// 响应内容中需要重试的标记
+	bodyRetry BodyRetryMarkers
+
+	// 是否合并同时进行的相同GET请求
+	singleFlight bool
+
+	// 设置重定向检查前的 Client 与是否只允许同host的重定向, 用于 ReplayWith
+	baseClient *http.Client
+	sameHost bool
+
+	// 重试时使用的代理池, 第一次请求不使用代理
+	proxyOnRetry *proxyPool
+
+	// 设置代理前 Client 的 Transport, 代理池按它复制使用代理的 Transport
+	proxyBase *http.Transport
+
+	// 每次请求使用的代理池与本次使用的代理, 见 WithProxyPool
+	proxyPool *proxyPool
+	proxyUsed *url.URL
+
+	// 是否已执行全局的url改写
+	rewritten bool
+
+	// 响应内容落盘目录
+	teeDir TeeDir
+
+	// 落盘的 body 是否gzip压缩
+	teeGzip bool
+
+	// 读取响应body的超时时间, 0 不限制
+	readTimeOut time.Duration
+
+	// 每次发送请求前对请求的设置
+	reqFuncs []ReqFunc
+
+	// 所属并发抓取的中止状态, 见 AbortCrawl
+	abort *crawlAbort
+
 }
 
 // SetSucceedFunc 设置成功后的方法
@@ -113,6 +243,35 @@ func (c *Context) SetRetryFunc(retryFunc func(c *Context)) {
 	c.RetryFunc = retryFunc
 }
 
+// AbortCrawl 中止所属的并发抓取(StartJobGet), 不再分发新的任务, StartJobGet 返回 reason
+// 不是由 StartJobGet 执行的请求调用无效果
+func (c *Context) AbortCrawl(reason error) {
+	if c.abort == nil {
+		log.Println("[AbortCrawl] context is not in a crawl.")
+		return
+	}
+	c.abort.abort(reason)
+}
+
+// SetFallbackFunc 设置每次重试发送请求前的方法
+func (c *Context) SetFallbackFunc(fallbackFunc func(c *Context, attempt int)) {
+	c.FallbackFunc = fallbackFunc
+}
+
+// SetFileFunc 设置状态码对应 "file" 事件的方法
+func (c *Context) SetFileFunc(fileFunc func(c *Context)) {
+	c.FileFunc = fileFunc
+}
+
+// OnStatus 注册指定状态码的方法, 响应为该状态码时读取body后执行, 代替 StatusCodeMap 对应的事件
+// 如 401 重新登录后再次 c.Do(), 404 记录后跳过
+func (c *Context) OnStatus(code int, fn func(c *Context)) {
+	if c.statusFuncs == nil {
+		c.statusFuncs = make(map[int]func(c *Context))
+	}
+	c.statusFuncs[code] = fn
+}
+
 // SetRetryTimes 设置重试次数
 func (c *Context) SetRetryTimes(times int) {
 	c.MaxTimes = RetryTimes(times)
@@ -126,6 +285,25 @@ func (c *Context) Do() func(){
 		log.Println("空对象")
 		return nil
 	}
+	if c.Req == nil {
+		c.logln("请求为空")
+		c.Err = ReqNull
+		if c.FailedFunc != nil{
+			c.FailedFunc(c)
+		}
+		return nil
+	}
+	if c.Client == nil {
+		c.Client = defaultClient
+	}
+
+	// 第一次执行时统计完成的请求, 重试在其中递归执行, 只计一次
+	if c.times == 0 {
+		c.succeeded = false
+		if c.stats != nil {
+			defer func() { c.stats.addPage(c.succeeded) }()
+		}
+	}
 
 	//执行 start
 	if c.times == 0 && c.StartFunc != nil{
@@ -140,27 +318,72 @@ func (c *Context) Do() func(){
 	//重试验证
 	c.times++
 	if c.times > c.MaxTimes{
-		log.Println("请求失败操过", c.MaxTimes, "次了")
+		c.logln("请求失败操过", c.MaxTimes, "次了")
+		return nil
+	}
+
+	// host的重试次数已用完, 新的请求直接失败
+	if c.times == 1 && c.Req.URL != nil && hostRetryExhausted(c.Req.URL) {
+		c.Err = HostRetryExhausted
+		if c.FailedFunc != nil{
+			c.FailedFunc(c)
+		}
 		return nil
 	}
 
 	//执行请求
+	if c.times > 1 {
+		c.resetBody()
+		if c.proxyOnRetry != nil && c.proxyPool == nil {
+			c.useProxy(c.proxyOnRetry)
+		}
+		if c.FallbackFunc != nil {
+			c.FallbackFunc(c, int(c.times)-1)
+		}
+	}
+	if c.proxyPool != nil {
+		c.proxyUsed = c.useProxy(c.proxyPool)
+	}
+	c.prepare()
+	c.trace()
 	before := time.Now()
-	c.Resp,c.Err = c.Client.Do(c.Req)
+	c.reqStart = before
+	c.TTFB = 0
+	c.timingMux.Lock()
+	c.Timing = Timing{}
+	c.timingMux.Unlock()
+	c.transactions = nil
+	c.Resp,c.Err = c.send()
 	c.Ms = time.Now().Sub(before)
+	c.reportProxy()
+	c.RespCookies = nil
+	if c.Resp != nil {
+		c.RespCookies = c.Resp.Cookies()
+		c.transactions = append(c.transactions, newTransaction(c.Resp))
+	}
+	if c.Err != nil {
+		c.stat()
+	}
 
-	// 是否超时
-	if c.Err != nil && strings.Contains(c.Err.Error(), "(Client.Timeout exceeded while awaiting headers)"){
-		if c.RetryFunc != nil {
-			c.RetryFunc(c)
+	// 是否超时或临时的错误
+	// 使用代理池时连接错误都换一个代理重试, RetryFunc 可不设置
+	// 没有使用代理池也没有设置 RetryFunc 时不重试, 也不占用host的重试次数
+	// 使用代理池时重试次数用完后执行 FailedFunc
+	if c.Err != nil && (retryableErr(c.Err) || c.proxyUsed != nil) && c.retryAllowed() {
+		if c.RetryFunc == nil && c.proxyUsed == nil {
+			return nil
+		}
+		if (c.proxyUsed == nil || c.times < c.MaxTimes) && c.takeRetry() {
+			if c.RetryFunc != nil {
+				c.RetryFunc(c)
+			}
 			return c.Do()
 		}
-		return nil
 	}
 
 	// 其他错误
 	if c.Err != nil {
-		log.Println("err = ", c.Err)
+		c.logln("err = ", c.Err)
 		if c.FailedFunc != nil{
 			c.FailedFunc(c)
 		}
@@ -175,19 +398,97 @@ func (c *Context) Do() func(){
 
 	//log.Println("状态码：", c.Resp.StatusCode)
 
+	// 注册了该状态码的方法, 读取body后执行该方法, 不再执行状态码对应的事件
+	if f, ok := c.statusFuncs[c.Resp.StatusCode]; ok {
+		body, err := c.readBodyTimeout()
+		c.Ms = time.Now().Sub(before)
+		c.stat()
+		if err != nil {
+			c.logln(err)
+			c.Err = err
+		}
+		c.RespBody = body
+		f(c)
+		return nil
+	}
+
+	// 设置了分类方法时先读取body, 由分类方法决定执行的事件
+	event, ok := StatusCodeMap[c.Resp.StatusCode]
+	if classify := getClassifier(); classify != nil {
+		body, err := c.readBodyTimeout()
+		if err != nil {
+			c.Ms = time.Now().Sub(before)
+			c.stat()
+			c.logln(err)
+			c.Err = err
+			if retryableBodyErr(err) && c.canRetry() {
+				if c.RetryFunc != nil{
+					c.RetryFunc(c)
+				}
+				return c.Do()
+			}
+			if c.FailedFunc != nil{
+				c.FailedFunc(c)
+			}
+			return nil
+		}
+		c.RespBody = body
+		c.Resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		event, ok = string(classify(c)), true
+	}
+
+	// 成功的请求在读取完body后统计
+	if event != "success" {
+		c.stat()
+	}
+
 	// 根据状态码配置的事件了类型进行该事件的方法
-	if v,ok := StatusCodeMap[c.Resp.StatusCode]; ok{
-		switch v {
+	if ok{
+		switch event {
 
 		case "success":
 			//log.Println("执行 success 事件", c.SucceedFunc)
 			//请求后的结果
-			body, err := ioutil.ReadAll(c.Resp.Body)
+			body, err := c.readBodyTimeout()
+			c.Ms = time.Now().Sub(before)
+			if err == nil {
+				c.RespBody = body
+			}
+			c.stat()
+			if retryableBodyErr(err) {
+				c.logln("第", c.times, "请求读取body失败 : ", err)
+				c.Err = err
+				if !c.canRetry() {
+					if c.FailedFunc != nil{
+						c.FailedFunc(c)
+					}
+					return nil
+				}
+				if c.RetryFunc != nil{
+					c.RetryFunc(c)
+				}
+				return c.Do()
+			}
 			if err != nil{
-				log.Println(err)
+				c.logln(err)
 				return nil
 			}
-			c.RespBody = body
+			// 响应内容包含重试的标记
+			if c.bodyRetry.match(body) {
+				c.logln("第", c.times, "请求失败,响应内容需要重试.")
+				if c.times >= c.MaxTimes || !c.canRetry() {
+					if c.FailedFunc != nil{
+						c.FailedFunc(c)
+					}
+					return nil
+				}
+				if c.RetryFunc != nil{
+					c.RetryFunc(c)
+				}
+				return c.Do()
+			}
+			c.sniff()
+			c.succeeded = true
 			//执行成功方法
 			if c.SucceedFunc != nil {
 				c.SucceedFunc(c)
@@ -196,28 +497,55 @@ func (c *Context) Do() func(){
 
 		case "retry":
 			//log.Println("执行 retry 事件")
-			log.Println("第", c.times, "请求失败,状态码： ", c.Resp.StatusCode, ".")
+			c.logln("第", c.times, "请求失败,状态码： ", c.Resp.StatusCode, ".")
+			// 非幂等的请求不重试, 直接失败
+			if !c.canRetry() {
+				if c.FailedFunc != nil{
+					c.FailedFunc(c)
+				}
+				return nil
+			}
 			//执行重试前的方法
 			if c.RetryFunc != nil{
 				c.RetryFunc(c)
 			}
 			return c.Do()
 
-		case "file":
-			//log.Println("执行 file 事件")
+		case "fail":
 			if c.FailedFunc != nil{
 				c.FailedFunc(c)
 			}
 			return nil
 
+		case "file":
+			// 没有设置 FileFunc 时与之前一样执行失败方法
+			if c.FileFunc == nil {
+				if c.FailedFunc != nil{
+					c.FailedFunc(c)
+				}
+				return nil
+			}
+			body, err := c.readBodyTimeout()
+			if err != nil{
+				c.logln(err)
+				c.Err = err
+				if c.FailedFunc != nil{
+					c.FailedFunc(c)
+				}
+				return nil
+			}
+			c.RespBody = body
+			c.FileFunc(c)
+			return nil
+
 		case "start":
 			//TODO : 请求前的方法
-			log.Println("执行 start 事件")
+			c.logln("执行 start 事件")
 			return nil
 
 			case "end":
 				//TODO : 请求结束后的方法
-				log.Println("执行 end 事件")
+				c.logln("执行 end 事件")
 				return nil
 
 		}
@@ -226,16 +554,197 @@ func (c *Context) Do() func(){
 	return nil
 }
 
-// add header
+// logln 输出日志, 设置了 RequestID 时带上请求ID
+func (c *Context) logln(v ...interface{}) {
+	if c.RequestID != "" {
+		v = append([]interface{}{"[" + c.RequestID + "]"}, v...)
+	}
+	log.Println(v...)
+}
+
+// DoN 顺序执行 n 次相同的请求, 返回每次的响应时间, 用于测试接口或预热缓存
+// 每次执行前重置重试次数、响应、错误等状态, 包括重试的请求时间只记最后一次
+func (c *Context) DoN(n int) []time.Duration {
+	list := make([]time.Duration, 0, n)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			c.reset()
+		}
+		c.Do()
+		list = append(list, c.Ms)
+	}
+	return list
+}
+
+// reset 重置请求状态, 用于再次执行相同的请求
+func (c *Context) reset() {
+	c.times = 0
+	c.Resp = nil
+	c.Err = nil
+	c.RespBody = nil
+	c.Ms = 0
+	c.TTFB = 0
+	c.Timing = Timing{}
+	c.SniffedType = ""
+	c.RespCookies = nil
+	c.RedirectLoop = nil
+	c.transactions = nil
+	c.resetBody()
+}
+
+// 幂等的请求方法, 重复请求不会产生副作用
+var idempotentMethod = map[string]bool{
+	"": true,
+	"GET": true,
+	"HEAD": true,
+	"PUT": true,
+	"DELETE": true,
+	"OPTIONS": true,
+	"TRACE": true,
+}
+
+// retryableErr 请求的错误是否可以重试
+// 等待响应头超时与临时的DNS错误可以重试; 域名不存在(no such host)重试也不会成功, 直接失败
+func retryableErr(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+	return strings.Contains(err.Error(), "(Client.Timeout exceeded while awaiting headers)")
+}
+
+// retryableBodyErr 读取body的错误是否可以重试: 读取超时, gzip压缩的响应被截断(连接中断)或损坏
+func retryableBodyErr(err error) bool {
+	if err == BodyReadTimeOut || err == gzip.ErrChecksum || err == gzip.ErrHeader {
+		return true
+	}
+	var corrupt flate.CorruptInputError
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &corrupt)
+}
+
+// match 响应内容是否包含任一标记
+func (m BodyRetryMarkers) match(body []byte) bool {
+	for _, marker := range m {
+		if marker != "" && bytes.Contains(body, []byte(marker)) {
+			return true
+		}
+	}
+	return false
+}
+
+// canRetry 是否可以自动重试
+// POST/PATCH 等非幂等的请求重试可能导致重复提交, 需要通过 RetryNonIdempotent() 明确开启
+// host的重试次数用完后不再重试, 见 SetHostRetryBudget
+func (c *Context) canRetry() bool {
+	return c.retryAllowed() && c.takeRetry()
+}
+
+// retryAllowed 请求的method是否允许自动重试, 不占用host的重试次数
+func (c *Context) retryAllowed() bool {
+	return c.Req == nil || c.RetryNonIdempotent || idempotentMethod[c.Req.Method]
+}
+
+// takeRetry 占用一次host的重试次数, 已用完返回 false
+// 已达到 MaxTimes 时不会再发送请求, 不占用次数
+func (c *Context) takeRetry() bool {
+	if c.Req == nil || c.Req.URL == nil || c.times >= c.MaxTimes {
+		return true
+	}
+	if !takeHostRetry(c.Req.URL) {
+		c.logln("[HostRetryBudget] ", c.Req.URL.Host, " 重试次数已用完")
+		return false
+	}
+	return true
+}
+
+// resetBody 重试前重置请求body, 第一次请求已经读完了body
+// body 不能重新读取(如流式的 io.Reader, 没有 GetBody)时输出警告, 重试发送的body为空或不完整
+func (c *Context) resetBody() {
+	if c.Req == nil || c.Req.Body == nil || c.Req.Body == http.NoBody {
+		return
+	}
+	if c.Req.GetBody == nil {
+		c.logln("[Warning] 第", c.times, "次请求重试, 请求body不能重新读取(没有 GetBody), 重试发送的body为空; 请使用 NewRequest 或可重复读取的body")
+		return
+	}
+	body, err := c.Req.GetBody()
+	if err != nil {
+		c.logln("reset body err = ", err)
+		return
+	}
+	c.Req.Body = body
+}
+
+// readBodyTimeout 读取响应 body, 超过 readTimeOut 时关闭 body 中止读取, 返回 BodyReadTimeOut
+func (c *Context) readBodyTimeout() ([]byte, error) {
+	if c.readTimeOut <= 0 {
+		return c.readBody()
+	}
+	var timeout int32
+	resp := c.Resp
+	timer := time.AfterFunc(c.readTimeOut, func() {
+		atomic.StoreInt32(&timeout, 1)
+		_ = resp.Body.Close()
+	})
+	body, err := c.readBody()
+	timer.Stop()
+	if atomic.LoadInt32(&timeout) == 1 {
+		return body, BodyReadTimeOut
+	}
+	return body, err
+}
+
+// AddHeader 添加header, 已有同名的header时追加一个值(同名header会有多个值)
 func (c *Context) AddHeader(k,v string) {
 	c.Req.Header.Add(k,v)
 }
 
+// SetHeader 设置header, 替换同名header已有的值
+func (c *Context) SetHeader(k,v string) {
+	c.Req.Header.Set(k,v)
+}
+
 // add Cookie
 func (c *Context) AddCookie(cookie *http.Cookie){
 	c.Req.AddCookie(cookie)
 }
 
+// prepare 发送请求前执行 ReqFunc 与全局的url改写
+func (c *Context) prepare() {
+	for _, f := range c.reqFuncs {
+		f(c.Req)
+	}
+	if !c.rewritten {
+		c.rewritten = true
+		if rewriter := getURLRewriter(); rewriter != nil {
+			rewriter(c.Req.URL)
+		}
+	}
+}
+
+// AddReqFunc 添加每次发送请求前(包括重试)对请求设置的方法
+func (c *Context) AddReqFunc(reqFunc ReqFunc) {
+	c.reqFuncs = append(c.reqFuncs, reqFunc)
+}
+
+// DownloadStat 下载的结果
+type DownloadStat struct {
+	// 保存的路径
+	Path string
+
+	// 下载的大小
+	Size int64
+
+	// 响应头 Content-Length 的大小, 没有则为0
+	Total int64
+
+	// 下载用时
+	Time time.Duration
+
+	// 读取的次数, 除最后一次外每次读满缓冲
+	Reads int
+}
+
 // Upload 下载
 func (c *Context) Upload(filePath string) func(){
 	//空验证
@@ -247,15 +756,16 @@ func (c *Context) Upload(filePath string) func(){
 	//重试验证
 	c.times++
 	if c.times > c.MaxTimes{
-		log.Println("请求失败操过", c.MaxTimes, "次了")
+		c.logln("请求失败操过", c.MaxTimes, "次了")
 		return nil
 	}
 
 	//执行请求
+	c.prepare()
 	c.Resp,c.Err = c.Client.Do(c.Req)
 
-	// 是否超时
-	if c.Err != nil && strings.Contains(c.Err.Error(), "(Client.Timeout exceeded while awaiting headers)"){
+	// 是否超时或临时的错误
+	if c.Err != nil && retryableErr(c.Err){
 		if c.RetryFunc != nil {
 			c.RetryFunc(c)
 			return c.Do()
@@ -265,7 +775,7 @@ func (c *Context) Upload(filePath string) func(){
 
 	// 其他错误
 	if c.Err != nil {
-		log.Println("err = ", c.Err)
+		c.logln("err = ", c.Err)
 		if c.FailedFunc != nil{
 			c.FailedFunc(c)
 		}
@@ -286,32 +796,253 @@ func (c *Context) Upload(filePath string) func(){
 
 	contentLength := Str2Float64(c.Resp.Header.Get("Content-Length"))
 	var sum int64 = 0
-	buf := make([]byte, 1024*100)
+	size := c.bufferSize
+	if size <= 0 {
+		size = defaultDownloadBufferSize
+	}
+	buf := make([]byte, size)
+	body := newBandwidthReader(c.Resp.Body, c.bandwidth)
 	st := time.Now()
 	i := 0
 	for {
-		i++
-		n, err := c.Resp.Body.Read(buf)
-		sum=sum+int64(n)
-		if err != nil || n == 0{
+		n, err := io.ReadFull(body, buf)
+		if n > 0 {
+			i++
+			sum=sum+int64(n)
 			f.Write(buf[:n])
+		}
+		if err != nil {
 			break
 		}
-		f.Write(buf[:n])
-		if i%9 == 0{
-			log.Println("[下载] ", filePath, " : ", FileSizeFormat(sum),"/", FileSizeFormat(int64(contentLength)),
+		if i%9 == 0 && !c.silentDownload{
+			c.logln("[下载] ", filePath, " : ", FileSizeFormat(sum),"/", FileSizeFormat(int64(contentLength)),
 				" |\t ", math.Floor((float64(sum)/contentLength)*100),"%")
 		}
 	}
 	ct := time.Now().Sub(st)
-	log.Println("[下载] ", filePath, " : ", FileSizeFormat(sum),"/", FileSizeFormat(int64(contentLength)),
-		" |\t ", math.Floor((float64(sum)/contentLength)*100), "%", "|\t ", ct )
+	c.DownloadStat = &DownloadStat{
+		Path: filePath,
+		Size: sum,
+		Total: int64(contentLength),
+		Time: ct,
+		Reads: i,
+	}
+	if !c.silentDownload {
+		c.logln("[下载] ", filePath, " : ", FileSizeFormat(sum),"/", FileSizeFormat(int64(contentLength)),
+			" |\t ", math.Floor((float64(sum)/contentLength)*100), "%", "|\t ", ct )
+	}
 
 
 	//loger(" rep header ", c.Resp.ContentLength)
 	return nil
 }
 
+// sameHostRedirect 只跟随同host的重定向
+// 复制一份 Client 再设置 CheckRedirect, 不影响使用方传入的 Client
+func (c *Context) sameHostRedirect() {
+	client := *c.Client
+	checkRedirect := client.CheckRedirect
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > 0 && req.URL.Host != via[0].URL.Host {
+			c.OffHostLocation = req.URL.String()
+			return OffHostRedirect
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	c.Client = &client
+}
+
+// detectRedirectLoop 重定向到已经请求过的地址时中止请求, c.Err 为 ErrRedirectLoop
+// 循环的地址保存在 c.RedirectLoop, 如 [A B A]
+// 第一次回到某个地址时如果中间的响应设置了cookie(如 A -> /login -> A 登录后跳回)不算循环, 第二次回到该地址时中止
+// 复制一份 Client 再设置 CheckRedirect, 不影响使用方传入的 Client
+func (c *Context) detectRedirectLoop() {
+	client := *c.Client
+	checkRedirect := client.CheckRedirect
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.Response != nil {
+			c.transactions = append(c.transactions, newTransaction(req.Response))
+		}
+		first, n := -1, 0
+		for i, v := range via {
+			if v.URL.String() == req.URL.String() {
+				if first < 0 {
+					first = i
+				}
+				n++
+			}
+		}
+		if n == 1 && redirectSetCookie(via[first+1:], req.Response) {
+			n = 0
+		}
+		if n > 0 {
+			loop := make([]string, 0, len(via)-first+1)
+			for _, r := range via[first:] {
+				loop = append(loop, r.URL.String())
+			}
+			c.RedirectLoop = append(loop, req.URL.String())
+			return ErrRedirectLoop
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	c.Client = &client
+}
+
+// redirectSetCookie 重定向经过的响应是否设置了cookie
+// via 中每个请求的 Response 是重定向到该请求的响应, last 为最后一个重定向的响应
+func redirectSetCookie(via []*http.Request, last *http.Response) bool {
+	for _, r := range via {
+		if r.Response != nil && len(r.Response.Header["Set-Cookie"]) > 0 {
+			return true
+		}
+	}
+	return last != nil && len(last.Header["Set-Cookie"]) > 0
+}
+
+// Transaction 请求经过的一跳, 跟随重定向时每个重定向是一跳
+type Transaction struct {
+	Method string
+	Url string
+
+	// 该跳发送的请求头, 包括 Client 的 cookie jar 添加的 Cookie
+	RequestHeader http.Header
+
+	StatusCode int
+	ResponseHeader http.Header
+
+	// 该跳响应设置的cookie(Set-Cookie)
+	Cookies []*http.Cookie
+}
+
+func newTransaction(resp *http.Response) Transaction {
+	t := Transaction{
+		StatusCode: resp.StatusCode,
+		ResponseHeader: resp.Header.Clone(),
+		Cookies: resp.Cookies(),
+	}
+	if resp.Request != nil {
+		t.Method = resp.Request.Method
+		t.Url = resp.Request.URL.String()
+		t.RequestHeader = resp.Request.Header.Clone()
+	}
+	return t
+}
+
+// Transactions 最后一次请求(重试时为最后一次重试)经过的每一跳, 按顺序为每个重定向与最终的响应
+// 用于分析登录等多次重定向并设置cookie的流程, 可以用 ReplayWith 修改后重新发送某一步
+func (c *Context) Transactions() []Transaction {
+	return append([]Transaction{}, c.transactions...)
+}
+
+// Describe 返回请求实际生效的配置, 用于调试多个选项组合后的效果
+// 包括请求、超时、重试、请求头(Cookie 与 Authorization 隐藏值)、代理与设置的回调方法
+func (c *Context) Describe() string {
+	var b strings.Builder
+	if c.Req != nil {
+		fmt.Fprintf(&b, "request: %s %s\n", c.Req.Method, c.Req.URL)
+	} else {
+		b.WriteString("request: <nil>\n")
+	}
+	client := c.Client
+	if client == nil {
+		client = defaultClient
+	}
+	fmt.Fprintf(&b, "timeout: %v\n", client.Timeout)
+	if c.readTimeOut > 0 {
+		fmt.Fprintf(&b, "read timeout: %v\n", c.readTimeOut)
+	}
+	fmt.Fprintf(&b, "max times: %d\n", c.MaxTimes)
+	fmt.Fprintf(&b, "retry non-idempotent: %v\n", c.RetryNonIdempotent)
+	if len(c.bodyRetry) > 0 {
+		fmt.Fprintf(&b, "retry on body: %q\n", []string(c.bodyRetry))
+	}
+	if c.Req != nil {
+		keys := make([]string, 0, len(c.Req.Header))
+		for k := range c.Req.Header {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			v := strings.Join(c.Req.Header[k], ", ")
+			if k == "Cookie" || k == "Authorization" {
+				v = "***"
+			}
+			fmt.Fprintf(&b, "header: %s: %s\n", k, v)
+		}
+		if t, ok := client.Transport.(*http.Transport); ok && t.Proxy != nil {
+			if u, err := t.Proxy(c.Req); err == nil && u != nil {
+				fmt.Fprintf(&b, "proxy: %s://%s\n", u.Scheme, u.Host)
+			}
+		}
+	}
+	if c.proxyOnRetry != nil {
+		fmt.Fprintf(&b, "proxy on retry: %d proxies\n", c.proxyOnRetry.Len())
+	}
+	if c.proxyPool != nil {
+		fmt.Fprintf(&b, "proxy pool: %d proxies\n", c.proxyPool.Len())
+	}
+	if c.bandwidth > 0 {
+		fmt.Fprintf(&b, "bandwidth limit: %s/s\n", FileSizeFormat(c.bandwidth))
+	}
+	if c.bufferSize > 0 {
+		fmt.Fprintf(&b, "download buffer: %s\n", FileSizeFormat(int64(c.bufferSize)))
+	}
+	if c.teeDir != "" {
+		fmt.Fprintf(&b, "tee dir: %s\n", c.teeDir)
+	}
+	if c.RequestID != "" {
+		fmt.Fprintf(&b, "request id: %s\n", c.RequestID)
+	}
+	funcs := make([]string, 0)
+	for name, set := range map[string]bool{
+		"start": c.StartFunc != nil, "succeed": c.SucceedFunc != nil, "failed": c.FailedFunc != nil,
+		"retry": c.RetryFunc != nil, "fallback": c.FallbackFunc != nil, "end": c.EndFunc != nil,
+		"file": c.FileFunc != nil,
+	} {
+		if set {
+			funcs = append(funcs, name)
+		}
+	}
+	sort.Strings(funcs)
+	fmt.Fprintf(&b, "funcs: %s\n", strings.Join(funcs, ", "))
+	return b.String()
+}
+
+// Response 返回响应的副本, Body 为已读取的 RespBody 的新 reader, 可以被再次读取
+// 用于需要 *http.Response 的其他库
+func (c *Context) Response() *http.Response {
+	if c.Resp == nil {
+		return nil
+	}
+	resp := *c.Resp
+	resp.Header = c.Resp.Header.Clone()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(c.RespBody))
+	resp.ContentLength = int64(len(c.RespBody))
+	return &resp
+}
+
+// FinalURL 跟随重定向后最终请求的url
+func (c *Context) FinalURL() string {
+	if c.Resp != nil && c.Resp.Request != nil && c.Resp.Request.URL != nil {
+		return c.Resp.Request.URL.String()
+	}
+	if c.Req != nil && c.Req.URL != nil {
+		return c.Req.URL.String()
+	}
+	return ""
+}
 
 // CookieNext
 func (c *Context) CookieNext() error {
@@ -328,6 +1059,99 @@ func (c *Context) CookieNext() error {
 	return nil
 }
 
+// Requeue 复制当前任务, 经 modify 修改后重新加入队列, 任务的 Retry 加1
+// 用于失败后更换镜像地址或补充数据再次抓取
+func (c *Context) Requeue(queue TodoQueue, modify func(task *Task)) error {
+	if queue == nil {
+		return errors.New("queue is nil")
+	}
+	var task *Task
+	if c.Task != nil {
+		task = c.Task.Clone()
+	} else if c.Req != nil {
+		task = &Task{Url: c.Req.URL.String()}
+	} else {
+		return errors.New("Task is nil")
+	}
+	task.Retry++
+	if modify != nil {
+		modify(task)
+	}
+	return queue.Add(task)
+}
+
+// ReplayWith 复制当前的请求, 经 modify 修改后返回新的 Context, 调用 Do 发送, 用于调试时修改后重新发送
+// 新的 Context 使用相同的 Client 与回调等配置, 重试次数、响应等状态为初始值; 当前 Context 不受影响
+func (c *Context) ReplayWith(modify func(req *http.Request)) (*Context, error) {
+	if c.Req == nil {
+		return nil, ReqNull
+	}
+	ctx := c.reqCtx
+	if ctx == nil {
+		ctx = c.Req.Context()
+	}
+	req := c.Req.Clone(ctx)
+	if c.Req.GetBody != nil {
+		body, err := c.Req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+	client := c.baseClient
+	if client == nil {
+		client = c.Client
+	}
+	nc := &Context{
+		Token: c.Token,
+		Client: client,
+		Req: req,
+		Ctx: c.Ctx,
+		MaxTimes: c.MaxTimes,
+		RetryNonIdempotent: c.RetryNonIdempotent,
+		SucceedFunc: c.SucceedFunc,
+		FailedFunc: c.FailedFunc,
+		RetryFunc: c.RetryFunc,
+		FallbackFunc: c.FallbackFunc,
+		StartFunc: c.StartFunc,
+		EndFunc: c.EndFunc,
+		FileFunc: c.FileFunc,
+		statusFuncs: c.statusFuncs,
+		Task: c.Task,
+		JobNumber: c.JobNumber,
+		stats: c.stats,
+		silentDownload: c.silentDownload,
+		bandwidth: c.bandwidth,
+		bufferSize: c.bufferSize,
+		bodyRetry: c.bodyRetry,
+		singleFlight: c.singleFlight,
+		proxyOnRetry: c.proxyOnRetry,
+		proxyPool: c.proxyPool,
+		rewritten: c.rewritten,
+		teeDir: c.teeDir,
+		teeGzip: c.teeGzip,
+		readTimeOut: c.readTimeOut,
+		reqFuncs: c.reqFuncs,
+		baseClient: c.baseClient,
+		sameHost: c.sameHost,
+	}
+	if c.RequestID != "" {
+		nc.RequestID = newRequestID()
+		if req.Header.Get("X-Request-ID") == c.RequestID {
+			req.Header.Set("X-Request-ID", nc.RequestID)
+		}
+	}
+	if modify != nil {
+		modify(req)
+	}
+	if nc.baseClient != nil {
+		if nc.sameHost {
+			nc.sameHostRedirect()
+		}
+		nc.detectRedirectLoop()
+	}
+	return nc, nil
+}
 
 // CookiePool   cookie池
 type cookiePool struct {
@@ -343,11 +1167,17 @@ func (c *cookiePool) Add(cookie *http.Cookie){
 	c.cookie = append(c.cookie, cookie)
 }
 
-func (c *cookiePool) Get() *http.Cookie {
+// Get 随机获取一个cookie, 池为空时返回错误
+func (c *cookiePool) Get() (*http.Cookie, error) {
 	c.mux.Lock()
 	defer c.mux.Unlock()
-	n := rand.Int63n(int64(len(c.cookie)))
-	return c.cookie[n]
+	switch len(c.cookie) {
+	case 0:
+		return nil, errors.New("cookie pool is empty.")
+	case 1:
+		return c.cookie[0], nil
+	}
+	return c.cookie[rand.Intn(len(c.cookie))], nil
 }
 
 
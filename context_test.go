@@ -0,0 +1,909 @@
+package gathertool
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequeue(t *testing.T) {
+	queue := NewQueue()
+	c, err := Get("http://a.example.com/page/1", &Task{
+		Url:  "http://a.example.com/page/1",
+		Data: map[string]interface{}{"page": 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Requeue(queue, func(task *Task) {
+		task.Url = strings.Replace(task.Url, "a.example.com", "b.example.com", 1)
+		task.Data["mirror"] = "b"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task := queue.Poll()
+	if task.Url != "http://b.example.com/page/1" {
+		t.Fatalf("Url = %s", task.Url)
+	}
+	if task.Retry != 1 {
+		t.Fatalf("Retry = %d", task.Retry)
+	}
+	if _, ok := c.Task.Data["mirror"]; ok || c.Task.Retry != 0 {
+		t.Fatal("original task was modified")
+	}
+}
+
+func TestFinalURL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	c, err := Get(ts.URL + "/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.FinalURL() != ts.URL+"/old" {
+		t.Fatalf("FinalURL before Do = %s", c.FinalURL())
+	}
+	c.Do()
+	if c.FinalURL() != ts.URL+"/new" {
+		t.Fatalf("FinalURL = %s", c.FinalURL())
+	}
+	if (&Context{}).FinalURL() != "" {
+		t.Fatal("FinalURL on empty Context should be empty")
+	}
+}
+
+func TestRetryNonIdempotent(t *testing.T) {
+	times := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		times++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	failed := false
+	c, err := PostJson(ts.URL, `{"a":1}`, RetryTimes(3), FailedFunc(func(c *Context) {
+		failed = true
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if times != 1 || !failed {
+		t.Fatalf("POST requested %d times, failed = %v", times, failed)
+	}
+
+	times = 0
+	c, err = PostJson(ts.URL, `{"a":1}`, RetryTimes(3), RetryNonIdempotent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if times != 3 {
+		t.Fatalf("POST with RetryNonIdempotent requested %d times", times)
+	}
+
+	times = 0
+	c, err = Get(ts.URL, RetryTimes(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if times != 3 {
+		t.Fatalf("GET requested %d times", times)
+	}
+}
+
+func TestSameHostRedirectsOnly(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("redirect to other host was followed")
+	}))
+	defer other.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, other.URL+"/c", http.StatusFound)
+		}
+	}))
+	defer ts.Close()
+
+	failed := false
+	c, err := Get(ts.URL+"/a", SameHostRedirectsOnly(), FailedFunc(func(c *Context) {
+		failed = true
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if !failed || !errors.Is(c.Err, OffHostRedirect) {
+		t.Fatalf("failed = %v, err = %v", failed, c.Err)
+	}
+	if c.OffHostLocation != other.URL+"/c" {
+		t.Fatalf("OffHostLocation = %s", c.OffHostLocation)
+	}
+}
+
+func TestResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "snapshot")
+	}))
+	defer ts.Close()
+
+	c, err := Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Response() != nil {
+		t.Fatal("Response before Do should be nil")
+	}
+	c.Do()
+	for i := 0; i < 2; i++ {
+		b, err := ioutil.ReadAll(c.Response().Body)
+		if err != nil || string(b) != string(c.RespBody) {
+			t.Fatalf("body = %q, RespBody = %q, err = %v", b, c.RespBody, err)
+		}
+	}
+	if c.Response().StatusCode != 200 {
+		t.Fatal("StatusCode")
+	}
+}
+
+func TestSetHeader(t *testing.T) {
+	c, err := Get("http://127.0.0.1", http.Header{"User-Agent": {"gathertool"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ua := c.Req.Header["User-Agent"]; len(ua) != 1 || ua[0] != "gathertool" {
+		t.Fatalf("User-Agent = %v", ua)
+	}
+
+	c.AddHeader("X-A", "1")
+	c.AddHeader("X-A", "2")
+	if v := c.Req.Header["X-A"]; len(v) != 2 {
+		t.Fatalf("AddHeader X-A = %v", v)
+	}
+	c.SetHeader("X-A", "3")
+	c.SetHeader("X-A", "4")
+	if v := c.Req.Header["X-A"]; len(v) != 1 || v[0] != "4" {
+		t.Fatalf("SetHeader X-A = %v", v)
+	}
+}
+
+func TestSilentDownload(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 1024*1024*2))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	c, err := Get(ts.URL, SilentDownload())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Upload(filepath.Join(dir, "a.bin"))
+	if buf.Len() != 0 {
+		t.Fatalf("log output: %s", buf.String())
+	}
+	if c.DownloadStat == nil || c.DownloadStat.Size != 1024*1024*2 {
+		t.Fatalf("DownloadStat = %+v", c.DownloadStat)
+	}
+}
+
+func TestDoN(t *testing.T) {
+	times := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		times++
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	c, err := PostJson(ts.URL, `{"n":1}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := c.DoN(5)
+	if len(list) != 5 || times != 5 {
+		t.Fatalf("samples = %d, requests = %d", len(list), times)
+	}
+	for _, d := range list {
+		if d <= 0 {
+			t.Fatalf("samples = %v", list)
+		}
+	}
+	if string(c.RespBody) != `{"n":1}` {
+		t.Fatalf("body = %q", c.RespBody)
+	}
+}
+
+func TestRespCookies(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+		http.SetCookie(w, &http.Cookie{Name: "lang", Value: "zh"})
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	var inCallback int
+	c, err := Get(ts.URL, SucceedFunc(func(c *Context) {
+		inCallback = len(c.RespCookies)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if inCallback != 2 || len(c.RespCookies) != 2 {
+		t.Fatalf("callback saw %d cookies, RespCookies = %v", inCallback, c.RespCookies)
+	}
+	if c.RespCookies[0].Name != "session" || c.RespCookies[0].Value != "abc" || c.RespCookies[1].Value != "zh" {
+		t.Fatalf("RespCookies = %v", c.RespCookies)
+	}
+}
+
+func TestDoNilClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	c := &Context{Req: req, MaxTimes: 1}
+	c.Do()
+	if c.Err != nil || string(c.RespBody) != "ok" || c.Client != defaultClient {
+		t.Fatalf("err = %v, body = %q", c.Err, c.RespBody)
+	}
+
+	failed := false
+	c = &Context{MaxTimes: 1, FailedFunc: func(c *Context) {
+		failed = true
+	}}
+	c.Do()
+	if c.Err != ReqNull || !failed {
+		t.Fatalf("err = %v, failed = %v", c.Err, failed)
+	}
+}
+
+func TestReadTimeOut(t *testing.T) {
+	var times int32
+	stall := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&times, 1)
+		w.Header().Set("Content-Length", "100")
+		fmt.Fprint(w, "partial")
+		w.(http.Flusher).Flush()
+		<-stall
+	}))
+	defer ts.Close()
+	defer close(stall)
+
+	retried := 0
+	c, err := Get(ts.URL, RetryTimes(2), ReadTimeOutMs(50), RetryFunc(func(c *Context) {
+		retried++
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	c.Do()
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("Do took %v", d)
+	}
+	if c.Err != BodyReadTimeOut || atomic.LoadInt32(&times) != 2 || retried != 2 {
+		t.Fatalf("err = %v, times = %d, retried = %d", c.Err, times, retried)
+	}
+}
+
+func TestDNSErrorRetry(t *testing.T) {
+	dial := func(dnsErr *net.DNSError) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return nil, &net.OpError{Op: "dial", Net: network, Err: dnsErr}
+			},
+		}}
+	}
+
+	retried, failed := 0, 0
+	retry := RetryFunc(func(c *Context) { retried++ })
+	fail := FailedFunc(func(c *Context) { failed++ })
+
+	// 域名不存在, 不重试直接失败
+	c, err := Get("http://gathertool.invalid/", dial(&net.DNSError{Err: "no such host", Name: "gathertool.invalid", IsNotFound: true}), RetryTimes(3), retry, fail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if retried != 0 || failed != 1 {
+		t.Fatalf("no such host: retried = %d, failed = %d", retried, failed)
+	}
+
+	// 临时的DNS错误, 重试
+	retried, failed = 0, 0
+	c, err = Get("http://gathertool.invalid/", dial(&net.DNSError{Err: "server misbehaving", Name: "gathertool.invalid", IsTemporary: true}), RetryTimes(3), retry, fail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if retried != 3 {
+		t.Fatalf("temporary: retried = %d, failed = %d", retried, failed)
+	}
+}
+
+func TestFileFunc(t *testing.T) {
+	StatusCodeFileEvent(299)
+	defer delete(StatusCodeMap, 299)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(299)
+		fmt.Fprint(w, "report")
+	}))
+	defer ts.Close()
+
+	var file, failed string
+	fileFunc := FileFunc(func(c *Context) { file = string(c.RespBody) })
+	failedFunc := FailedFunc(func(c *Context) { failed = c.Req.URL.Path })
+
+	c, err := Get(ts.URL+"/report", fileFunc, failedFunc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if file != "report" || failed != "" {
+		t.Fatalf("file = %q, failed = %q", file, failed)
+	}
+
+	// 404 对应 "fail" 事件, 执行失败方法
+	c, err = Get(ts.URL+"/missing", fileFunc, failedFunc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if failed != "/missing" {
+		t.Fatalf("failed = %q", failed)
+	}
+}
+
+func TestOnStatus(t *testing.T) {
+	token := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer new" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, "token expired")
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	retried, failed := 0, 0
+	c, err := Get(ts.URL, RetryTimes(3), RetryFunc(func(c *Context) { retried++ }), FailedFunc(func(c *Context) { failed++ }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reauth []string
+	c.OnStatus(http.StatusUnauthorized, func(c *Context) {
+		reauth = append(reauth, string(c.RespBody))
+		token = "new"
+		c.SetHeader("Authorization", "Bearer "+token)
+		c.Do()
+	})
+	c.Do()
+	if len(reauth) != 1 || reauth[0] != "token expired" || string(c.RespBody) != "ok" {
+		t.Fatalf("reauth = %v, body = %q", reauth, c.RespBody)
+	}
+	if retried != 0 || failed != 0 {
+		t.Fatalf("retried = %d, failed = %d", retried, failed)
+	}
+}
+
+func TestWithBandwidthLimit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 3000))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := time.Now()
+	if err := Upload(ts.URL, filepath.Join(dir, "a.bin"), WithBandwidthLimit(2000), SilentDownload()); err != nil {
+		t.Fatal(err)
+	}
+	// 3000 字节每秒 2000 字节, 约 1.5 秒
+	if d := time.Since(start); d < 1200*time.Millisecond || d > 5*time.Second {
+		t.Fatalf("download took %v", d)
+	}
+	info, err := os.Stat(filepath.Join(dir, "a.bin"))
+	if err != nil || info.Size() != 3000 {
+		t.Fatalf("size = %v, err = %v", info, err)
+	}
+}
+
+func TestFallbackFunc(t *testing.T) {
+	var agents []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.Header.Get("X-Bot"))
+		if r.Header.Get("X-Bot") != "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	var attempts []int
+	c, err := Get(ts.URL, RetryTimes(3), http.Header{"X-Bot": {"1"}}, FallbackFunc(func(c *Context, attempt int) {
+		attempts = append(attempts, attempt)
+		c.Req.Header.Del("X-Bot")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if string(c.RespBody) != "ok" || len(agents) != 2 || fmt.Sprint(attempts) != "[1]" {
+		t.Fatalf("body = %q, agents = %v, attempts = %v", c.RespBody, agents, attempts)
+	}
+}
+
+func TestRedirectLoop(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		switch r.URL.Path {
+		case "/start":
+			http.Redirect(w, r, "/a", http.StatusFound)
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, "/a", http.StatusFound)
+		}
+	}))
+	defer ts.Close()
+
+	failed := false
+	c, err := Get(ts.URL+"/start", FailedFunc(func(c *Context) {
+		failed = true
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if !failed || !errors.Is(c.Err, ErrRedirectLoop) {
+		t.Fatalf("failed = %v, err = %v", failed, c.Err)
+	}
+	want := []string{ts.URL + "/a", ts.URL + "/b", ts.URL + "/a"}
+	if fmt.Sprint(c.RedirectLoop) != fmt.Sprint(want) || hits != 3 {
+		t.Fatalf("RedirectLoop = %v, hits = %d", c.RedirectLoop, hits)
+	}
+}
+
+func TestRedirectLoopCookieBounce(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "abc", Path: "/"})
+			http.Redirect(w, r, r.URL.Query().Get("next"), http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/login?next=/loop", http.StatusFound)
+		default:
+			if _, err := r.Cookie("sid"); err != nil {
+				http.Redirect(w, r, "/login?next=/a", http.StatusFound)
+				return
+			}
+			fmt.Fprint(w, "ok")
+		}
+	}))
+	defer ts.Close()
+
+	// A -> /login(设置cookie) -> A 不算循环
+	jar, _ := cookiejar.New(nil)
+	c, err := Get(ts.URL+"/a", &http.Client{Jar: jar})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if c.Err != nil || string(c.RespBody) != "ok" {
+		t.Fatalf("body = %q, err = %v", c.RespBody, c.Err)
+	}
+
+	// 设置了cookie仍然第二次回到该地址, 是循环
+	jar, _ = cookiejar.New(nil)
+	c, _ = Get(ts.URL+"/loop", &http.Client{Jar: jar})
+	c.Do()
+	if !errors.Is(c.Err, ErrRedirectLoop) || len(c.RedirectLoop) != 5 {
+		t.Fatalf("err = %v, RedirectLoop = %v", c.Err, c.RedirectLoop)
+	}
+}
+
+func TestHostRetryBudget(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(503)
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	SetHostRetryBudget(u.Hostname(), 3)
+	defer SetHostRetryBudget(u.Hostname(), 0)
+
+	failed := 0
+	get := func() *Context {
+		c, err := Get(ts.URL, RetryTimes(10), RetryFunc(func(c *Context) {}), FailedFunc(func(c *Context) { failed++ }))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Do()
+		return c
+	}
+
+	// 第一次请求加3次重试后用完
+	get()
+	if n := atomic.LoadInt32(&hits); n != 4 || failed != 1 {
+		t.Fatalf("hits = %d, failed = %d", n, failed)
+	}
+	// 之后的请求直接失败, 不发送请求
+	if c := get(); c.Err != HostRetryExhausted || failed != 2 {
+		t.Fatalf("err = %v, failed = %d", c.Err, failed)
+	}
+	if n := atomic.LoadInt32(&hits); n != 4 {
+		t.Fatalf("hits = %d", n)
+	}
+}
+
+func TestHostRetryBudgetOnlyOnRetry(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		w.WriteHeader(503)
+	}))
+	defer ts.Close()
+	SetHostRetryBudget("127.0.0.1", 5)
+	defer SetHostRetryBudget("127.0.0.1", 0)
+	used := func() int {
+		hostRetryBudgetMux.Lock()
+		defer hostRetryBudgetMux.Unlock()
+		return hostRetryBudget["127.0.0.1"].used
+	}
+
+	// 没有 RetryFunc 的超时不重试, 不占用次数
+	c, _ := Get(ts.URL+"/slow", ReqTimeOutMs(100))
+	c.Do()
+	if c.Err == nil || used() != 0 {
+		t.Fatalf("used = %d", used())
+	}
+	// 只有实际发送的重试占用次数, 达到 MaxTimes 后不再占用
+	c, _ = Get(ts.URL, RetryTimes(2), RetryFunc(func(c *Context) {}))
+	c.Do()
+	if used() != 1 {
+		t.Fatalf("used = %d", used())
+	}
+}
+
+func TestSetClassifier(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 前两次返回 200 但响应头表示被限流
+		if atomic.AddInt32(&hits, 1) <= 2 {
+			w.Header().Set("X-Block", "1")
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	SetClassifier(func(c *Context) Action {
+		if c.Resp.Header.Get("X-Block") != "" {
+			return ActionRetry
+		}
+		if string(c.RespBody) != "ok" {
+			return ActionFail
+		}
+		return ActionSuccess
+	})
+	defer SetClassifier(nil)
+
+	succeed := false
+	c, err := Get(ts.URL, RetryFunc(func(c *Context) {}), SucceedFunc(func(c *Context) { succeed = true }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if !succeed || atomic.LoadInt32(&hits) != 3 || string(c.RespBody) != "ok" {
+		t.Fatalf("succeed = %v, hits = %d, body = %q", succeed, hits, c.RespBody)
+	}
+}
+
+func TestRetryOnBodyContains(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) <= 2 {
+			fmt.Fprint(w, `{"error":"rate limited"}`)
+			return
+		}
+		fmt.Fprint(w, `{"data":"ok"}`)
+	}))
+	defer ts.Close()
+
+	retries, succeed := 0, false
+	c, err := Get(ts.URL, RetryOnBodyContains("rate limited", "captcha"),
+		RetryFunc(func(c *Context) { retries++ }),
+		SucceedFunc(func(c *Context) { succeed = true }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if retries != 2 || !succeed || string(c.RespBody) != `{"data":"ok"}` {
+		t.Fatalf("retries = %d, succeed = %v, body = %s", retries, succeed, c.RespBody)
+	}
+
+	// 重试次数用完执行失败方法
+	atomic.StoreInt32(&hits, 0)
+	failed := false
+	c, _ = Get(ts.URL, RetryOnBodyContains("rate limited"), RetryTimes(2), RetryFunc(func(c *Context) {}),
+		FailedFunc(func(c *Context) { failed = true }))
+	c.Do()
+	if atomic.LoadInt32(&hits) != 2 || !failed {
+		t.Fatalf("hits = %d, failed = %v", hits, failed)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	c, err := Get("http://example.com/a", ReqTimeOut(7), RetryTimes(3), &http.Cookie{Name: "sid", Value: "secret"},
+		RetryOnBodyContains("captcha"), FailedFunc(func(c *Context) {}), SucceedFunc(func(c *Context) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Describe()
+	for _, want := range []string{
+		"request: GET http://example.com/a\n",
+		"timeout: 7s\n",
+		"max times: 3\n",
+		"retry on body: [\"captcha\"]\n",
+		"header: Cookie: ***\n",
+		"funcs: failed, succeed\n",
+	} {
+		if !strings.Contains(d, want) {
+			t.Fatalf("describe missing %q:\n%s", want, d)
+		}
+	}
+	if strings.Contains(d, "secret") {
+		t.Fatalf("describe leaks cookie:\n%s", d)
+	}
+}
+
+func TestTruncatedGzipRetry(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write(bytes.Repeat([]byte("gathertool "), 1000))
+	_ = gz.Close()
+	full := buf.Bytes()
+
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		if atomic.AddInt32(&hits, 1) == 1 {
+			// 声明完整的长度, 只发送一半后断开连接
+			w.Header().Set("Content-Length", strconv.Itoa(len(full)))
+			_, _ = w.Write(full[:len(full)/2])
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		_, _ = w.Write(full)
+	}))
+	defer ts.Close()
+
+	retries := 0
+	c, err := Get(ts.URL, RetryFunc(func(c *Context) { retries++ }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if retries != 1 || atomic.LoadInt32(&hits) != 2 || len(c.RespBody) != 11000 {
+		t.Fatalf("retries = %d, hits = %d, body = %d", retries, hits, len(c.RespBody))
+	}
+}
+
+func TestReplayWith(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s|%s", r.Header.Get("X-Debug"), body)
+	}))
+	defer ts.Close()
+
+	succeed := 0
+	c, err := PostJson(ts.URL, `{"a":1}`, SucceedFunc(func(c *Context) { succeed++ }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if string(c.RespBody) != `|{"a":1}` {
+		t.Fatalf("body = %q", c.RespBody)
+	}
+	timing, ttfb := c.Timing, c.TTFB
+
+	nc, err := c.ReplayWith(func(req *http.Request) {
+		req.Header.Set("X-Debug", "1")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc.Do()
+	if string(nc.RespBody) != `1|{"a":1}` || succeed != 2 {
+		t.Fatalf("replay body = %q, succeed = %d", nc.RespBody, succeed)
+	}
+	if c.Req.Header.Get("X-Debug") != "" || string(c.RespBody) != `|{"a":1}` {
+		t.Fatal("original context changed")
+	}
+	// 新请求的 httptrace 只记录到新的 Context
+	if c.Timing != timing || c.TTFB != ttfb || nc.TTFB == 0 {
+		t.Fatalf("timing = %+v, want %+v, ttfb = %v, want %v, replay ttfb = %v", c.Timing, timing, c.TTFB, ttfb, nc.TTFB)
+	}
+}
+
+func TestRetryConsumedBodyWarning(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(&hits, 1) == 1 {
+			w.WriteHeader(502)
+			return
+		}
+		w.Write(body)
+	}))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	// 流式的body没有 GetBody, 重试时不能重新发送
+	req, err := http.NewRequest("PUT", ts.URL, ioutil.NopCloser(strings.NewReader("data")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Req(req, RetryFunc(func(c *Context) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if atomic.LoadInt32(&hits) != 2 || len(c.RespBody) != 0 {
+		t.Fatalf("hits = %d, body = %q", hits, c.RespBody)
+	}
+	if !strings.Contains(buf.String(), "[Warning]") || !strings.Contains(buf.String(), "GetBody") {
+		t.Fatalf("log output: %s", buf.String())
+	}
+
+	// 可以重新读取的body不输出警告
+	buf.Reset()
+	atomic.StoreInt32(&hits, 0)
+	c, _ = Put(ts.URL, []byte("data"), "text/plain", RetryFunc(func(c *Context) {}))
+	c.Do()
+	if string(c.RespBody) != "data" || strings.Contains(buf.String(), "[Warning]") {
+		t.Fatalf("body = %q, log output: %s", c.RespBody, buf.String())
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "step", Value: "1"})
+			http.Redirect(w, r, "/auth", http.StatusFound)
+		case "/auth":
+			http.SetCookie(w, &http.Cookie{Name: "token", Value: "abc"})
+			http.Redirect(w, r, "/home", http.StatusFound)
+		default:
+			fmt.Fprint(w, "home")
+		}
+	}))
+	defer ts.Close()
+
+	jar, _ := cookiejar.New(nil)
+	c, err := Get(ts.URL+"/login", &http.Client{Jar: jar})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	list := c.Transactions()
+	if len(list) != 3 {
+		t.Fatalf("transactions = %+v", list)
+	}
+	if list[0].Url != ts.URL+"/login" || list[0].StatusCode != 302 || len(list[0].Cookies) != 1 || list[0].Cookies[0].Value != "1" {
+		t.Fatalf("hop 0 = %+v", list[0])
+	}
+	if list[1].Url != ts.URL+"/auth" || list[1].Cookies[0].Name != "token" || list[1].RequestHeader.Get("Cookie") != "step=1" {
+		t.Fatalf("hop 1 = %+v", list[1])
+	}
+	if list[2].Url != ts.URL+"/home" || list[2].StatusCode != 200 || len(list[2].Cookies) != 0 ||
+		!strings.Contains(list[2].RequestHeader.Get("Cookie"), "token=abc") {
+		t.Fatalf("hop 2 = %+v", list[2])
+	}
+}
+
+func TestDownloadBufferSize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 100*1024))
+	}))
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		vs    []interface{}
+		reads int
+	}{
+		{[]interface{}{SilentDownload()}, 1},
+		{[]interface{}{SilentDownload(), WithDownloadBufferSize(8 * 1024)}, 13},
+		{[]interface{}{SilentDownload(), WithDownloadBufferSize(1)}, 25}, // 最小 4KB
+	}
+	for _, cs := range cases {
+		c, _ := Get(ts.URL, cs.vs...)
+		c.Upload(filepath.Join(dir, "a.bin"))
+		if c.DownloadStat == nil || c.DownloadStat.Size != 100*1024 || c.DownloadStat.Reads != cs.reads {
+			t.Fatalf("DownloadStat = %+v, want %d reads", c.DownloadStat, cs.reads)
+		}
+	}
+}
+
+func TestCookiePoolGet(t *testing.T) {
+	pool := &cookiePool{}
+	if c, err := pool.Get(); err == nil || c != nil {
+		t.Fatalf("empty pool: cookie = %v, err = %v", c, err)
+	}
+	pool.Add(&http.Cookie{Name: "a", Value: "1"})
+	if c, err := pool.Get(); err != nil || c.Name != "a" {
+		t.Fatalf("cookie = %v, err = %v", c, err)
+	}
+	pool.Add(&http.Cookie{Name: "b", Value: "2"})
+	for i := 0; i < 10; i++ {
+		if c, err := pool.Get(); err != nil || (c.Name != "a" && c.Name != "b") {
+			t.Fatalf("cookie = %v, err = %v", c, err)
+		}
+	}
+}
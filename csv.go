@@ -9,6 +9,11 @@ type Csv struct {
 	FileName string
 	W *csv.Writer
 	R *csv.Reader
+
+	f *os.File
+	// 每写入多少行 flush 并 fsync 一次, 0 只在 Close 时写入
+	syncEvery int
+	rows int
 }
 
 func NewCsv(fileName string) *Csv {
@@ -21,9 +26,8 @@ func NewCsv(fileName string) *Csv {
 	if err != nil {
 		loger(err.Error())
 	}
-	defer f.Close()
 
-	csvObj := &Csv{FileName: fileName}
+	csvObj := &Csv{FileName: fileName, f: f}
 
 	csvObj.W = csv.NewWriter(f)
 	csvObj.R = csv.NewReader(f)
@@ -31,10 +35,41 @@ func NewCsv(fileName string) *Csv {
 	return csvObj
 }
 
+// SetSyncEvery 每写入 n 行 flush 并 fsync 一次, 程序崩溃时最多丢失 n 行, n 越小写入越慢; n <= 0 只在 Close 时写入
+func (c *Csv) SetSyncEvery(n int) {
+	c.syncEvery = n
+}
+
 func (c *Csv) Add(data []string) error{
-	return c.W.Write(data)
+	if err := c.W.Write(data); err != nil {
+		return err
+	}
+	c.rows++
+	if c.syncEvery > 0 && c.rows%c.syncEvery == 0 {
+		return c.Sync()
+	}
+	return nil
+}
+
+// Sync 将缓存的数据写入文件并 fsync
+func (c *Csv) Sync() error {
+	c.W.Flush()
+	if err := c.W.Error(); err != nil {
+		return err
+	}
+	return c.f.Sync()
+}
+
+// Close 写入缓存的数据并关闭文件
+func (c *Csv) Close() error {
+	c.W.Flush()
+	if err := c.W.Error(); err != nil {
+		c.f.Close()
+		return err
+	}
+	return c.f.Close()
 }
 
 func (c *Csv) ReadAll() ([][]string, error){
 	return c.R.ReadAll()
-}
\ No newline at end of file
+}
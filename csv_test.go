@@ -0,0 +1,42 @@
+package gathertool
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCsvSyncEvery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 不调用 Close 模拟程序崩溃, 读取文件中已写入的内容
+	write := func(name string, syncEvery int) string {
+		c := NewCsv(filepath.Join(dir, name))
+		c.SetSyncEvery(syncEvery)
+		for _, row := range [][]string{{"a", "1"}, {"b", "2"}, {"c", "3"}} {
+			if err := c.Add(row); err != nil {
+				t.Fatal(err)
+			}
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	if got := write("sync.csv", 1); got != "\xEF\xBB\xBFa,1\nb,2\nc,3\n" {
+		t.Fatalf("sync every row = %q", got)
+	}
+	if got := write("sync2.csv", 2); got != "\xEF\xBB\xBFa,1\nb,2\n" {
+		t.Fatalf("sync every 2 rows = %q", got)
+	}
+	if got := write("nosync.csv", 0); got != "\xEF\xBB\xBF" {
+		t.Fatalf("no sync = %q", got)
+	}
+}
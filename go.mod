@@ -4,7 +4,13 @@ go 1.13
 
 require (
 	github.com/PuerkitoBio/goquery v1.6.1
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/garyburd/redigo v1.6.2
 	github.com/go-sql-driver/mysql v1.6.0
-	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
+	github.com/xitongsys/parquet-go v1.6.2
+	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550
+	golang.org/x/image v0.0.0-20210220032944-ac19c3e999fb
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
+	golang.org/x/text v0.3.6
+	gopkg.in/yaml.v2 v2.4.0
 )
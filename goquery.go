@@ -1,11 +1,228 @@
 package gathertool
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/text/encoding/simplifiedchinese"
 )
 
 func NewGoquery(html string) (*goquery.Document, error){
 	return goquery.NewDocumentFromReader(strings.NewReader(html))
-}
\ No newline at end of file
+}
+
+// NewGoqueryLenient 宽松解析html
+// html 看起来有问题(非utf8、含空字符、标签名前有空白、末尾有未闭合的标签)时先经 CleanHtml 清理再解析
+// html.Parse 几乎不会返回错误, 有问题的内容会被解析成错误的结构, 所以在解析前检查
+func NewGoqueryLenient(html string) (*goquery.Document, error){
+	if brokenHtml(html) {
+		html = CleanHtml(html)
+	}
+	return NewGoquery(html)
+}
+
+// brokenHtml html 是否有 CleanHtml 能清理的问题
+func brokenHtml(html string) bool {
+	return !utf8.ValidString(html) || strings.Contains(html, "\x00") ||
+		regTagSpace.MatchString(html) || regTagTail.MatchString(html)
+}
+
+var (
+	// 标签名前的空白 如 "< div>", "</ div>"
+	regTagSpace = regexp.MustCompile(`<(/?)\s+([a-zA-Z])`)
+	// 末尾未闭合的标签 如 "<p>txt</p", 不匹配文本中的 "<" 如 "价格 < 5"
+	regTagTail = regexp.MustCompile(`<[a-zA-Z/][^<>]*$`)
+)
+
+// CleanHtml 轻量清理html: 去除空字符, 修复标签名前的空白, 去除末尾未闭合的标签
+// 不是有效utf8的内容尝试按 GB18030(兼容GBK、GB2312) 转为utf8, 不能转换时原样保留, 不删除字符
+func CleanHtml(html string) string {
+	if !utf8.ValidString(html) {
+		if s, err := simplifiedchinese.GB18030.NewDecoder().String(html); err == nil && !strings.ContainsRune(s, utf8.RuneError) {
+			html = s
+		}
+	}
+	html = strings.Replace(html, "\x00", "", -1)
+	html = regTagSpace.ReplaceAllString(html, "<$1$2")
+	html = regTagTail.ReplaceAllString(html, "")
+	return html
+}
+
+// DiscoverAndEnqueuePages 发现页面中的数字分页链接(链接文字是页码, 如 "1" "2" "[3]")并加入队列
+// 链接按 baseURL 转为绝对地址, 同一个地址只加入一次, 不包含 baseURL 本身; 返回加入队列的任务数
+// 每一页都调用时使用 NewDedupQueue 创建的队列, 避免不同页面发现的相同页码重复抓取
+func DiscoverAndEnqueuePages(doc *goquery.Document, baseURL string, q TodoQueue) int {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		loger("base url is bad : ", err)
+		return 0
+	}
+	seen := map[string]bool{CanonicalURL(base.String()): true}
+	n := 0
+	doc.Find("a[href]").Each(func(i int, a *goquery.Selection) {
+		text := strings.Trim(strings.TrimSpace(a.Text()), "[]")
+		if page, err := strconv.Atoi(text); err != nil || page < 1 {
+			return
+		}
+		href, _ := a.Attr("href")
+		href = strings.TrimSpace(href)
+		if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+			return
+		}
+		u, err := base.Parse(href)
+		if err != nil {
+			return
+		}
+		u.Fragment = ""
+		key := CanonicalURL(u.String())
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		if err := q.Add(&Task{Url: u.String()}); err == nil {
+			n++
+		}
+	})
+	return n
+}
+
+// UnmarshalList 将 itemSelector 匹配的每个元素解析为一个结构体, 追加到 v, v 为结构体切片(或结构体指针切片)的指针
+// 结构体字段通过 tag `goquery:"选择器@属性"` 取值, 选择器相对于匹配的元素, 见 UnmarshalSelection
+func UnmarshalList(doc *goquery.Document, itemSelector string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return errors.New("v is not a pointer to slice.")
+	}
+	slice := rv.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return errors.New("slice element is not struct.")
+	}
+
+	var err error
+	doc.Find(itemSelector).EachWithBreak(func(i int, sel *goquery.Selection) bool {
+		item := reflect.New(elemType)
+		if err = unmarshalStruct(sel, item.Elem()); err != nil {
+			return false
+		}
+		if isPtr {
+			slice.Set(reflect.Append(slice, item))
+		} else {
+			slice.Set(reflect.Append(slice, item.Elem()))
+		}
+		return true
+	})
+	return err
+}
+
+// UnmarshalSelection 将元素解析到结构体, v 为结构体指针
+// 字段的 tag `goquery:"选择器@属性"`: 选择器为空取元素本身, 没有属性取文本, 多个匹配取第一个
+// 支持 string, int, uint, float, bool 类型的字段, 没有 tag 的字段不处理
+func UnmarshalSelection(sel *goquery.Selection, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("v is not a pointer to struct.")
+	}
+	return unmarshalStruct(sel, rv.Elem())
+}
+
+func unmarshalStruct(sel *goquery.Selection, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		selector, ok := field.Tag.Lookup("goquery")
+		if !ok || field.PkgPath != "" {
+			continue
+		}
+		if err := setFieldValue(rv.Field(i), selectValue(sel, selector)); err != nil {
+			return fmt.Errorf("field %s : %v", field.Name, err)
+		}
+	}
+	return nil
+}
+
+// setFieldValue 将文本转换为字段的类型并赋值, 空文本不赋值, 数字中的千分位逗号会被去除
+func setFieldValue(f reflect.Value, value string) error {
+	if value == "" {
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(strings.Replace(value, ",", "", -1), 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(strings.Replace(value, ",", "", -1), 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(strings.Replace(value, ",", "", -1), 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	default:
+		return errors.New("unsupported field type " + f.Type().String())
+	}
+	return nil
+}
+
+// ExtractJSONLD 解析页面中所有 <script type="application/ld+json"> 的结构化数据(schema.org)
+// 数组会展开为多个对象, 带 @graph 的对象展开为 @graph 中的对象; 数字为 json.Number, 见 SetJsonUseNumber
+func ExtractJSONLD(doc *goquery.Document) ([]map[string]interface{}, error) {
+	list := make([]map[string]interface{}, 0)
+	var err error
+	doc.Find(`script[type="application/ld+json"]`).EachWithBreak(func(i int, s *goquery.Selection) bool {
+		text := strings.TrimSpace(s.Text())
+		if text == "" {
+			return true
+		}
+		var v interface{}
+		if e := jsonUnmarshal([]byte(text), &v); e != nil {
+			err = fmt.Errorf("ld+json %d : %v", i, e)
+			return false
+		}
+		list = appendJSONLD(list, v)
+		return true
+	})
+	return list, err
+}
+
+// appendJSONLD 展开数组与 @graph 后添加对象
+func appendJSONLD(list []map[string]interface{}, v interface{}) []map[string]interface{} {
+	switch vv := v.(type) {
+	case []interface{}:
+		for _, item := range vv {
+			list = appendJSONLD(list, item)
+		}
+	case map[string]interface{}:
+		if graph, ok := vv["@graph"]; ok {
+			return appendJSONLD(list, graph)
+		}
+		list = append(list, vv)
+	}
+	return list
+}
@@ -0,0 +1,142 @@
+package gathertool
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCleanHtml(t *testing.T) {
+	broken := "<div><p class=\"a\">hello\x00 world</p>< span>gt</ span><i>\xbc\xdb\xb8\xf1 < 5</i></p"
+	want := "<div><p class=\"a\">hello world</p><span>gt</span><i>价格 < 5</i>"
+	if got := CleanHtml(broken); got != want {
+		t.Fatalf("CleanHtml = %q, want %q", got, want)
+	}
+	// 不能转换的字节原样保留
+	if got := CleanHtml("a\xffb"); got != "a\xffb" {
+		t.Fatalf("CleanHtml = %q", got)
+	}
+
+	doc, err := NewGoqueryLenient(broken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txt := doc.Find("p.a").Text(); txt != "hello world" {
+		t.Fatalf("p.a text = %q", txt)
+	}
+	if txt := doc.Find("span").Text(); txt != "gt" {
+		t.Fatalf("span text = %q", txt)
+	}
+
+	if txt := doc.Find("i").Text(); txt != "价格 < 5" {
+		t.Fatalf("i text = %q", txt)
+	}
+
+	// 没有问题的html不清理, 文本中的 "<" 不被删除
+	doc, err = NewGoqueryLenient("<p>价格 < 5")
+	if err != nil || doc.Find("p").Text() != "价格 < 5" {
+		t.Fatalf("text = %q, err = %v", doc.Find("p").Text(), err)
+	}
+}
+
+func TestDiscoverAndEnqueuePages(t *testing.T) {
+	html := `
+	<div class="pager">第 2 页 / 共 5 页
+		<a href="/country/CN?page=1">1</a>
+		<a href="/country/CN?page=2">2</a>
+		<a href="/country/CN?page=3">[3]</a>
+		<a href="page4">4</a>
+		<a href="/country/CN?page=3">下一页</a>
+		<a href="http://ip.bczs.net/country/CN?page=5#top">5</a>
+		<a href="javascript:void(0)">6</a>
+	</div>
+	<div class="pager">
+		<a href="/country/CN?page=1">1</a>
+		<a href="/country/CN?page=3">3</a>
+	</div>`
+	doc, err := NewGoquery(html)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queue := NewQueue().(*Queue)
+	n := DiscoverAndEnqueuePages(doc, "http://ip.bczs.net/country/CN?page=2", queue)
+	want := []string{
+		"http://ip.bczs.net/country/CN?page=1",
+		"http://ip.bczs.net/country/CN?page=3",
+		"http://ip.bczs.net/country/page4",
+		"http://ip.bczs.net/country/CN?page=5",
+	}
+	if n != len(want) || queue.Len() != len(want) {
+		t.Fatalf("n = %d, Len = %d", n, queue.Len())
+	}
+	for _, u := range want {
+		if task := queue.Poll(); task.Url != u {
+			t.Fatalf("task = %s, want %s", task.Url, u)
+		}
+	}
+}
+
+func TestUnmarshalList(t *testing.T) {
+	html := `<div id="result"><table><tbody>
+		<tr><td>1.0.1.0</td><td>1.0.3.255</td><td>512</td><td><a href="/1.0.1.0">福建省</a></td></tr>
+		<tr><td>1.0.8.0</td><td>1.0.15.255</td><td>2,048</td><td><a href="/1.0.8.0">广东省</a></td></tr>
+	</tbody></table></div>`
+	doc, err := NewGoquery(html)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type IPRange struct {
+		Start  string `goquery:"td:nth-child(1)"`
+		End    string `goquery:"td:nth-child(2)"`
+		Number int    `goquery:"td:nth-child(3)"`
+		Area   string `goquery:"a"`
+		Link   string `goquery:"a@href"`
+		Note   string
+	}
+	var list []IPRange
+	if err := UnmarshalList(doc, "div[id=result] tbody tr", &list); err != nil {
+		t.Fatal(err)
+	}
+	want := []IPRange{
+		{Start: "1.0.1.0", End: "1.0.3.255", Number: 512, Area: "福建省", Link: "/1.0.1.0"},
+		{Start: "1.0.8.0", End: "1.0.15.255", Number: 2048, Area: "广东省", Link: "/1.0.8.0"},
+	}
+	if len(list) != len(want) {
+		t.Fatalf("list = %+v", list)
+	}
+	for i := range want {
+		if list[i] != want[i] {
+			t.Fatalf("list[%d] = %+v, want %+v", i, list[i], want[i])
+		}
+	}
+
+	type bad struct {
+		Number int `goquery:"td:nth-child(1)"`
+	}
+	var bads []*bad
+	if err := UnmarshalList(doc, "tbody tr", &bads); err == nil {
+		t.Fatal("expected parse error")
+	}
+}
+
+func TestExtractJSONLD(t *testing.T) {
+	doc, err := NewGoquery(`<html><head>
+<script type="application/ld+json">{"@context": "https://schema.org", "@type": "Product", "name": "book", "sku": 1234567890123456789}</script>
+<script type="application/ld+json">{"@context": "https://schema.org", "@graph": [{"@type": "Organization", "name": "org"}, {"@type": "WebSite", "name": "site"}]}</script>
+<script type="application/json">{"@type": "Ignored"}</script>
+</head></html>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := ExtractJSONLD(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0]["name"] != "book" || list[1]["@type"] != "Organization" || list[2]["name"] != "site" {
+		t.Fatalf("list = %v", list)
+	}
+	if sku, _ := list[0]["sku"].(json.Number); sku.String() != "1234567890123456789" {
+		t.Fatalf("sku = %v", list[0]["sku"])
+	}
+}
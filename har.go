@@ -0,0 +1,110 @@
+package gathertool
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HAR 文件中需要的内容, 只解析请求部分
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request harRequest `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+type harRequest struct {
+	Method   string         `json:"method"`
+	Url      string         `json:"url"`
+	Headers  []harNameValue `json:"headers"`
+	PostData *struct {
+		MimeType string         `json:"mimeType"`
+		Text     string         `json:"text"`
+		Params   []harNameValue `json:"params"`
+	} `json:"postData"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// LoadHAR 解析浏览器导出的 HAR 文件, 按记录的顺序还原为请求(method, url, header, body), 执行 Do() 即可重放
+// vs 为每个请求的可变参数, 设置的 header 会覆盖 HAR 中记录的同名 header
+// HTTP/2 的伪header(如 :authority)与 Content-Length、Accept-Encoding、Host 不会还原
+func LoadHAR(path string, vs ...interface{}) ([]*Context, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	har := &harFile{}
+	if err := json.Unmarshal(b, har); err != nil {
+		return nil, err
+	}
+
+	list := make([]*Context, 0, len(har.Log.Entries))
+	for _, entry := range har.Log.Entries {
+		c, err := harContext(entry.Request, vs)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	return list, nil
+}
+
+// 不还原的 header
+// Accept-Encoding 由 Transport 设置并自动解压, 还原后响应的 body 为压缩的内容; Host 使用请求url的host
+var harSkipHeader = map[string]bool{
+	"Content-Length":  true,
+	"Accept-Encoding": true,
+	"Host":            true,
+}
+
+// harContext 还原一个请求
+func harContext(r harRequest, vs []interface{}) (*Context, error) {
+	header := http.Header{}
+	for _, h := range r.Headers {
+		if strings.HasPrefix(h.Name, ":") || harSkipHeader[http.CanonicalHeaderKey(h.Name)] {
+			continue
+		}
+		header.Add(h.Name, h.Value)
+	}
+
+	body := ""
+	if r.PostData != nil {
+		body = r.PostData.Text
+		if body == "" && len(r.PostData.Params) > 0 {
+			form := url.Values{}
+			for _, p := range r.PostData.Params {
+				form.Add(p.Name, p.Value)
+			}
+			body = form.Encode()
+		}
+		if header.Get("Content-Type") == "" && r.PostData.MimeType != "" {
+			header.Set("Content-Type", r.PostData.MimeType)
+		}
+	}
+
+	method := r.Method
+	if method == "" {
+		method = "GET"
+	}
+	if !isUrl(r.Url) {
+		return nil, UrlBad
+	}
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	request, err := http.NewRequest(method, r.Url, reader)
+	if err != nil {
+		return nil, err
+	}
+	return Req(request, append([]interface{}{header}, vs...)...)
+}
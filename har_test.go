@@ -0,0 +1,102 @@
+package gathertool
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadHAR(t *testing.T) {
+	var got []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		got = append(got, r.Method+" "+r.URL.RequestURI()+" "+r.Header.Get("Cookie")+" "+r.Header.Get("Content-Type")+" "+string(b))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "har")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "flow.har")
+	har := `{"log": {"version": "1.2", "entries": [
+		{"request": {"method": "GET", "url": "URL/list?page=1", "httpVersion": "HTTP/2",
+			"headers": [{"name": ":authority", "value": "example.com"}, {"name": "cookie", "value": "sid=abc"}, {"name": "user-agent", "value": "Mozilla/5.0 HAR"}]}},
+		{"request": {"method": "POST", "url": "URL/login",
+			"headers": [{"name": "Content-Length", "value": "999"}],
+			"postData": {"mimeType": "application/x-www-form-urlencoded", "params": [{"name": "user", "value": "mange"}, {"name": "pwd", "value": "1 2"}]}}}
+	]}}`
+	if err := ioutil.WriteFile(path, []byte(strings.Replace(har, "URL", ts.URL, -1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := LoadHAR(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("len = %d", len(list))
+	}
+	if list[0].Req.Method != "GET" || list[0].Req.Header.Get("User-Agent") != "Mozilla/5.0 HAR" || list[0].Req.Header.Get(":authority") != "" {
+		t.Fatalf("GET header = %v", list[0].Req.Header)
+	}
+	if list[1].Req.Method != "POST" || list[1].Req.ContentLength != int64(len("pwd=1+2&user=mange")) {
+		t.Fatalf("POST = %s %d", list[1].Req.Method, list[1].Req.ContentLength)
+	}
+	for _, c := range list {
+		c.Do()
+	}
+	want := []string{
+		"GET /list?page=1 sid=abc  ",
+		"POST /login  application/x-www-form-urlencoded pwd=1+2&user=mange",
+	}
+	if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("got = %q", got)
+	}
+}
+
+func TestLoadHARGzip(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			fmt.Fprint(w, "plain")
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		fmt.Fprint(gz, "hello gzip")
+		gz.Close()
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "har")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "gzip.har")
+	har := `{"log": {"entries": [{"request": {"method": "GET", "url": "URL/",
+		"headers": [{"name": "accept-encoding", "value": "gzip, deflate, br"}, {"name": "host", "value": "example.com"}]}}]}}`
+	if err := ioutil.WriteFile(path, []byte(strings.Replace(har, "URL", ts.URL, -1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := LoadHAR(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := list[0]
+	if c.Req.Header.Get("Accept-Encoding") != "" || c.Req.Header.Get("Host") != "" {
+		t.Fatalf("header = %v", c.Req.Header)
+	}
+	c.Do()
+	if string(c.RespBody) != "hello gzip" {
+		t.Fatalf("body = %q, err = %v", c.RespBody, c.Err)
+	}
+}
@@ -0,0 +1,134 @@
+package gathertool
+
+import (
+	"log"
+	"net/url"
+	"sync"
+)
+
+// 每个host在一次并发抓取中最多成功抓取的页面数
+var (
+	hostBudget    = make(map[string]int)
+	hostBudgetMux sync.RWMutex
+)
+
+// SetHostBudget 设置每个host在一次 StartJobGet 中最多成功抓取的页面数, 达到后该host剩余的任务跳过
+// host 可以带端口(如 "127.0.0.1:8080"), 不带端口时匹配该主机的所有端口; max <= 0 取消限制
+func SetHostBudget(host string, max int) {
+	hostBudgetMux.Lock()
+	defer hostBudgetMux.Unlock()
+	if max <= 0 {
+		delete(hostBudget, host)
+		return
+	}
+	hostBudget[host] = max
+}
+
+// getHostBudget 获取url对应host的限制, 没有设置返回 "", 0
+func getHostBudget(rawUrl string) (string, int) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", 0
+	}
+	hostBudgetMux.RLock()
+	defer hostBudgetMux.RUnlock()
+	if max, ok := hostBudget[u.Host]; ok {
+		return u.Host, max
+	}
+	if max, ok := hostBudget[u.Hostname()]; ok {
+		return u.Hostname(), max
+	}
+	return "", 0
+}
+
+// hostCounter 一次并发抓取中每个host的抓取计数
+// 分发前先占用一个名额, 请求失败后释放, 保证并发时成功数也不会超过限制
+type hostCounter struct {
+	count map[string]int
+	mux   sync.Mutex
+}
+
+func newHostCounter() *hostCounter {
+	return &hostCounter{count: make(map[string]int)}
+}
+
+// acquire 占用一个名额, 已达到限制返回 false
+func (h *hostCounter) acquire(rawUrl string) (string, bool) {
+	host, max := getHostBudget(rawUrl)
+	if max == 0 {
+		return "", true
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	if h.count[host] >= max {
+		log.Println("[HostBudget] ", host, " 已达到限制 ", max, ", 跳过 : ", rawUrl)
+		return host, false
+	}
+	h.count[host]++
+	return host, true
+}
+
+// release 请求没有成功, 释放占用的名额
+func (h *hostCounter) release(host string) {
+	if host == "" {
+		return
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.count[host]--
+}
+
+// 每个host全局最多的重试次数, 所有请求共用
+type hostRetry struct {
+	max  int
+	used int
+}
+
+var (
+	hostRetryBudget    = make(map[string]*hostRetry)
+	hostRetryBudgetMux sync.Mutex
+)
+
+// SetHostRetryBudget 设置host全局最多的重试次数, 所有请求的重试共用, 不受单个请求的 MaxTimes 影响
+// 用完后该host的请求不再重试, 新的请求直接失败, c.Err 为 HostRetryExhausted
+// host 可以带端口, 不带端口时匹配该主机的所有端口; 重新设置会清零已用的次数, max <= 0 取消限制
+func SetHostRetryBudget(host string, max int) {
+	hostRetryBudgetMux.Lock()
+	defer hostRetryBudgetMux.Unlock()
+	if max <= 0 {
+		delete(hostRetryBudget, host)
+		return
+	}
+	hostRetryBudget[host] = &hostRetry{max: max}
+}
+
+// getHostRetry 获取host的重试次数限制, 调用方需持有锁
+func getHostRetry(u *url.URL) *hostRetry {
+	if r, ok := hostRetryBudget[u.Host]; ok {
+		return r
+	}
+	return hostRetryBudget[u.Hostname()]
+}
+
+// takeHostRetry 占用一次host的重试次数, 已用完返回 false
+func takeHostRetry(u *url.URL) bool {
+	hostRetryBudgetMux.Lock()
+	defer hostRetryBudgetMux.Unlock()
+	r := getHostRetry(u)
+	if r == nil {
+		return true
+	}
+	if r.used >= r.max {
+		return false
+	}
+	r.used++
+	return true
+}
+
+// hostRetryExhausted host的重试次数是否已用完
+func hostRetryExhausted(u *url.URL) bool {
+	hostRetryBudgetMux.Lock()
+	defer hostRetryBudgetMux.Unlock()
+	r := getHostRetry(u)
+	return r != nil && r.used >= r.max
+}
@@ -0,0 +1,28 @@
+package gathertool
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+// Image 将响应内容解码为图片, 返回图片与格式(如 "png"), 支持 jpeg、png、gif、webp
+func (c *Context) Image() (image.Image, string, error) {
+	if len(c.RespBody) == 0 {
+		return nil, "", errors.New("response body is null.")
+	}
+	return image.Decode(bytes.NewReader(c.RespBody))
+}
+
+// ImageConfig 只解析图片头, 返回图片的宽高与颜色模型和格式, 比 Image 快很多
+func (c *Context) ImageConfig() (image.Config, string, error) {
+	if len(c.RespBody) == 0 {
+		return image.Config{}, "", errors.New("response body is null.")
+	}
+	return image.DecodeConfig(bytes.NewReader(c.RespBody))
+}
@@ -0,0 +1,31 @@
+package gathertool
+
+import (
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestImage(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_ = png.Encode(w, image.NewRGBA(image.Rect(0, 0, 3, 2)))
+	}))
+	defer ts.Close()
+
+	c, err := Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	cfg, format, err := c.ImageConfig()
+	if err != nil || format != "png" || cfg.Width != 3 || cfg.Height != 2 {
+		t.Fatalf("config = %+v, %s, %v", cfg, format, err)
+	}
+	img, _, err := c.Image()
+	if err != nil || img.Bounds().Dx() != 3 || img.Bounds().Dy() != 2 {
+		t.Fatalf("image = %v, %v", img, err)
+	}
+}
@@ -0,0 +1,76 @@
+package gathertool
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+)
+
+// 一次 EnqueueIPRange 最多的ip数量, 避免 IPv6 的大范围生成无数个任务
+const MaxIPRange = 1 << 20
+
+// EnqueueIPRange 按ip范围创建任务加入队列, 每个ip一个任务, 返回加入的任务数
+// startIP 为 CIDR(如 1.0.1.0/30) 时 endIP 传空; 支持 IPv4 与 IPv6
+// 范围内的ip超过 MaxIPRange 个时返回错误, 不加入任务
+// urlTemplate 中的 {ip} 替换为ip, 如 http://ip.bczs.net/{ip}; ip 同时保存到 Task.Data["ip"]
+func EnqueueIPRange(queue TodoQueue, startIP, endIP, urlTemplate string) (int, error) {
+	start, end, err := parseIPRange(startIP, endIP)
+	if err != nil {
+		return 0, err
+	}
+	v4 := start.To4() != nil && end.To4() != nil
+	if v4 {
+		start, end = start.To4(), end.To4()
+	}
+	s, e := new(big.Int).SetBytes(start), new(big.Int).SetBytes(end)
+	if s.Cmp(e) > 0 {
+		return 0, errors.New("start ip is greater than end ip")
+	}
+	count := new(big.Int).Sub(e, s)
+	if count.Add(count, big.NewInt(1)).Cmp(big.NewInt(MaxIPRange)) > 0 {
+		return 0, fmt.Errorf("ip range has %s ips, more than %d", count, MaxIPRange)
+	}
+
+	n := 0
+	one := big.NewInt(1)
+	size := len(start)
+	for i := s; i.Cmp(e) <= 0; i = new(big.Int).Add(i, one) {
+		b := i.Bytes()
+		ip := make(net.IP, size)
+		copy(ip[size-len(b):], b)
+		err := queue.Add(&Task{
+			Url:  strings.Replace(urlTemplate, "{ip}", ip.String(), -1),
+			Data: map[string]interface{}{"ip": ip.String()},
+		})
+		if err == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// parseIPRange 解析ip范围
+func parseIPRange(startIP, endIP string) (net.IP, net.IP, error) {
+	if endIP == "" && strings.Contains(startIP, "/") {
+		ip, ipNet, err := net.ParseCIDR(startIP)
+		if err != nil {
+			return nil, nil, err
+		}
+		start := ip.Mask(ipNet.Mask)
+		end := make(net.IP, len(start))
+		for i := range start {
+			end[i] = start[i] | ^ipNet.Mask[i]
+		}
+		return start, end, nil
+	}
+	start, end := net.ParseIP(startIP), net.ParseIP(endIP)
+	if start == nil || end == nil {
+		return nil, nil, errors.New("ip is bad : " + startIP + " - " + endIP)
+	}
+	if (start.To4() == nil) != (end.To4() == nil) {
+		return nil, nil, errors.New("ip version mismatch : " + startIP + " - " + endIP)
+	}
+	return start, end, nil
+}
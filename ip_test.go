@@ -0,0 +1,52 @@
+package gathertool
+
+import (
+	"testing"
+)
+
+func TestEnqueueIPRange(t *testing.T) {
+	queue := NewQueue()
+	n, err := EnqueueIPRange(queue, "1.0.1.5/30", "", "http://ip.bczs.net/{ip}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 || queue.Size() != 4 {
+		t.Fatalf("n = %d", n)
+	}
+	for _, ip := range []string{"1.0.1.4", "1.0.1.5", "1.0.1.6", "1.0.1.7"} {
+		task := queue.Poll()
+		if task.Url != "http://ip.bczs.net/"+ip || task.Data["ip"] != ip {
+			t.Fatalf("task = %+v", task)
+		}
+	}
+
+	n, err = EnqueueIPRange(queue, "1.0.1.255", "1.0.2.1", "{ip}")
+	if err != nil || n != 3 || queue.Poll().Url != "1.0.1.255" || queue.Poll().Url != "1.0.2.0" {
+		t.Fatalf("n = %d, err = %v", n, err)
+	}
+	queue.Clear()
+
+	n, err = EnqueueIPRange(queue, "2001:db8::fffe", "2001:db8::1:1", "{ip}")
+	if err != nil || n != 4 {
+		t.Fatalf("ipv6 n = %d, err = %v", n, err)
+	}
+	if task := queue.Poll(); task.Url != "2001:db8::fffe" {
+		t.Fatalf("ipv6 task = %+v", task)
+	}
+
+	if _, err := EnqueueIPRange(queue, "1.0.1.9", "1.0.1.1", "{ip}"); err == nil {
+		t.Fatal("expected error for reversed range")
+	}
+
+	// 超过 MaxIPRange 的范围返回错误, 不加入任务
+	before := queue.Size()
+	if _, err := EnqueueIPRange(queue, "2001:db8::/64", "", "{ip}"); err == nil {
+		t.Fatal("expected error for too large range")
+	}
+	if _, err := EnqueueIPRange(queue, "10.0.0.0/11", "", "{ip}"); err == nil {
+		t.Fatal("expected error for too large range")
+	}
+	if queue.Size() != before {
+		t.Fatalf("size = %d, want %d", queue.Size(), before)
+	}
+}
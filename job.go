@@ -1,11 +1,134 @@
 package gathertool
 
 import (
+	"fmt"
 	"log"
 	"net/http"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 )
 
+// 并发任务进度的方法类型, 每完成一个任务执行一次
+// done 已完成的任务数, remaining 队列中剩余的任务数, inflight 正在执行的任务数
+type ProgressFunc func(done, remaining, inflight int)
+
+// 并发任务中每个并发使用的client, workerID 为并发的编号(从0开始), 每个并发启动时执行一次
+// 用于每个并发使用独立的代理或cookie
+type ClientFactory func(workerID int) *http.Client
+
+// 并发任务的检查点, 见 Checkpoint
+type JobCheckpoint struct {
+	every int
+	fn    func(stats Stats, remaining int)
+}
+
+// Checkpoint 并发任务每完成 every 个任务执行一次 fn, 用于保存进度、刷新缓冲或输出日志
+// stats 为到此时的请求统计的副本(包括重试), remaining 为队列中剩余的任务数
+// fn 在单独的 goroutine 中按顺序执行, 不阻塞并发取新的任务, 任务结束前执行完所有的检查点
+func Checkpoint(every int, fn func(stats Stats, remaining int)) JobCheckpoint {
+	return JobCheckpoint{every: every, fn: fn}
+}
+
+// 等待执行的检查点
+type checkpointCall struct {
+	fn        func(stats Stats, remaining int)
+	stats     Stats
+	remaining int
+}
+
+// runCheckpoints 按顺序执行检查点, calls 关闭后返回
+func runCheckpoints(calls <-chan checkpointCall, done chan<- struct{}) {
+	defer close(done)
+	for call := range calls {
+		call.fn(call.stats, call.remaining)
+	}
+}
+
+// 并发任务中任务 panic 时是否恢复
+type JobRecover bool
+
+// DisableRecover 并发任务中任务 panic 时不恢复, 用于调试时直接看到 panic
+// 默认恢复: 记录日志与堆栈, 执行失败方法, 该并发继续执行后面的任务
+func DisableRecover() JobRecover {
+	return false
+}
+
+// runTask 执行任务, recoverPanic 为 true 时任务(包括回调方法)的 panic 不会中止并发
+func runTask(ctx *Context, task *Task, recoverPanic bool) {
+	if recoverPanic {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			log.Printf("[Job] 任务 panic : %s : %v\n%s", task.Url, r, debug.Stack())
+			ctx.Err = fmt.Errorf("task panic: %v", r)
+			if ctx.FailedFunc != nil {
+				defer func() {
+					if r := recover(); r != nil {
+						log.Printf("[Job] FailedFunc panic : %s : %v", task.Url, r)
+					}
+				}()
+				ctx.FailedFunc(ctx)
+			}
+		}()
+	}
+
+	switch task.Type {
+	case "","do":
+		ctx.Do()
+	case "upload":
+		if task.SavePath == ""{
+			task.SavePath = task.SaveDir + task.FileName
+		}
+		ctx.Upload(task.SavePath)
+	default:
+		ctx.Do()
+	}
+}
+
+// queueLen 队列的元素个数, 队列实现了并发安全的 Len 则使用 Len
+func queueLen(queue TodoQueue) int {
+	if q, ok := queue.(interface{ Len() int }); ok {
+		return q.Len()
+	}
+	return queue.Size()
+}
+
+// crawlAbort 一次并发抓取的中止状态, 由 StartJobGet 创建并设置到每个请求的 Context
+type crawlAbort struct {
+	once   sync.Once
+	mux    sync.Mutex
+	reason error
+	done   int32
+}
+
+// abort 中止抓取, 只记录第一次的原因
+func (a *crawlAbort) abort(reason error) {
+	a.once.Do(func() {
+		if reason == nil {
+			reason = CrawlAborted
+		}
+		a.mux.Lock()
+		a.reason = reason
+		a.mux.Unlock()
+		atomic.StoreInt32(&a.done, 1)
+	})
+}
+
+// aborted 是否已中止
+func (a *crawlAbort) aborted() bool {
+	return atomic.LoadInt32(&a.done) == 1
+}
+
+// err 中止的原因
+func (a *crawlAbort) err() error {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	return a.reason
+}
+
 //TODO:  StartJob 开始运行并发
 func StartJob(){}
 
@@ -14,16 +137,34 @@ func StartJob(){}
 // @jobNumber 并发数，
 // @queue 全局队列，
 // @client 单个并发任务的client，
+// @ClientFactory 每个并发使用独立的client, 优先于 client
 // @SucceedFunc 成功方法，
 // @ RetryFunc重试方法，
 // @FailedFunc 失败方法
-func StartJobGet(jobNumber int, queue TodoQueue, vs ...interface{}){
+// @http.Header 每个请求添加的header
+// @ProgressFunc 进度方法
+// @*Stats 请求统计
+// @JobCheckpoint 检查点, 见 Checkpoint
+// @JobRecover 任务 panic 时是否恢复, 默认恢复, 见 DisableRecover
+// 设置了 SetHostBudget 的host, 成功抓取的页面数达到限制后该host剩余的任务跳过
+// 任务中调用 Context.AbortCrawl 后不再分发新的任务, 返回中止的原因
+func StartJobGet(jobNumber int, queue TodoQueue, vs ...interface{}) error {
 
 	var (
 		client *http.Client
 		succeed SucceedFunc
 		retry RetryFunc
 		failed FailedFunc
+		header http.Header
+		progress ProgressFunc
+		factory ClientFactory
+		stats *Stats
+		checkpoints []JobCheckpoint
+		recoverPanic = JobRecover(true)
+		done, inflight int64
+		progressMux sync.Mutex
+		abort = &crawlAbort{}
+		budget = newHostCounter()
 	)
 
 	for _,v := range vs{
@@ -36,29 +177,76 @@ func StartJobGet(jobNumber int, queue TodoQueue, vs ...interface{}){
 			failed = vv
 		case RetryFunc:
 			retry = vv
+		case http.Header:
+			header = vv
+		case ProgressFunc:
+			progress = vv
+		case ClientFactory:
+			factory = vv
+		case *Stats:
+			stats = vv
+		case JobRecover:
+			recoverPanic = vv
+		case JobCheckpoint:
+			if vv.every > 0 && vv.fn != nil {
+				checkpoints = append(checkpoints, vv)
+			}
 			}
 	}
 
+	var (
+		checkpointCalls chan checkpointCall
+		checkpointDone  chan struct{}
+	)
+	if len(checkpoints) > 0 {
+		if stats == nil {
+			stats = NewStats()
+		}
+		checkpointCalls = make(chan checkpointCall, 64)
+		checkpointDone = make(chan struct{})
+		go runCheckpoints(checkpointCalls, checkpointDone)
+	}
+
 	var wg sync.WaitGroup
 	for job:=0;job<jobNumber;job++{
 		wg.Add(1)
 		go func(i int){
 			log.Println("启动第",i ,"个任务")
 			defer wg.Done()
+			workerClient := client
+			if factory != nil {
+				if cl := factory(i); cl != nil {
+					workerClient = cl
+				}
+			}
 			for {
-				if queue.IsEmpty(){
+				if abort.aborted() || queueLen(queue) == 0 {
 					break
 				}
 				task := queue.Poll()
+				if task == nil {
+					continue
+				}
+				host, ok := budget.acquire(task.Url)
+				if !ok {
+					continue
+				}
+				atomic.AddInt64(&inflight, 1)
 				log.Println("第",i,"个任务取的值： ", task)
-				ctx, err := Get(task.Url, task)
+				// Client 作为参数传入, 由 Req 设置重定向检查等
+				vs := []interface{}{task, header, stats}
+				if workerClient != nil {
+					vs = append(vs, workerClient)
+				}
+				ctx, err := Get(task.Url, vs...)
 				if err != nil {
 					log.Println(err)
+					budget.release(host)
+					atomic.AddInt64(&inflight, -1)
 					return
 				}
-				if client != nil {
-					ctx.Client = client
-				}
+				ctx.abort = abort
+				ctx.JobNumber = i
 				if succeed != nil {
 					ctx.SetSucceedFunc(succeed)
 				}
@@ -69,24 +257,38 @@ func StartJobGet(jobNumber int, queue TodoQueue, vs ...interface{}){
 					ctx.SetFailedFunc(failed)
 				}
 
-				switch task.Type {
-				case "","do":
-					ctx.Do()
-				case "upload":
-					if task.SavePath == ""{
-						task.SavePath = task.SaveDir + task.FileName
-					}
-					ctx.Upload(task.SavePath)
-				default:
-					ctx.Do()
+				runTask(ctx, task, bool(recoverPanic))
+				if !ctx.succeeded {
+					budget.release(host)
 				}
 
+				n := atomic.AddInt64(&done, 1)
+				m := atomic.AddInt64(&inflight, -1)
+				if progress != nil {
+					progressMux.Lock()
+					progress(int(n), queueLen(queue), int(m))
+					progressMux.Unlock()
+				}
+				for _, cp := range checkpoints {
+					if n%int64(cp.every) == 0 {
+						checkpointCalls <- checkpointCall{fn: cp.fn, stats: stats.Snapshot(), remaining: queueLen(queue)}
+					}
+				}
 			}
 			log.Println("第",i ,"个任务结束！！")
 		}(job)
 	}
 	wg.Wait()
+	if checkpointCalls != nil {
+		close(checkpointCalls)
+		<-checkpointDone
+	}
+	if abort.aborted() {
+		log.Println("抓取已中止： ", abort.err())
+		return abort.err()
+	}
 	log.Println("执行完成！！！")
+	return nil
 }
 
 
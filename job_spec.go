@@ -0,0 +1,195 @@
+/*
+	Description : 配置化的抓取任务, 从 YAML/JSON 文件定义抓取的url、请求头、提取的字段与写入的表
+	Author : ManGe
+	Version : v0.1
+	Date : 2021-04-29
+*/
+
+package gathertool
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"gopkg.in/yaml.v2"
+)
+
+// JobSpec 抓取任务配置
+//
+//	urls:                      # url, 支持 {1-3} 形式的页码范围
+//	  - http://example.com/list/{1-3}
+//	method: GET                # 目前只支持 GET
+//	headers:
+//	  Referer: http://example.com
+//	item: table tbody tr       # 每条数据的选择器, 为空则整个页面为一条数据
+//	fields:                    # 字段名: 选择器, "选择器@属性" 取属性值, 选择器为空取元素本身
+//	  name: td:nth-child(1)
+//	  link: a@href
+//	columns: [name, link]      # 输出的列, 为空则为全部字段
+//	table: ip_list             # 写入的表, 为空不写入
+//	workers: 10                # 并发数
+type JobSpec struct {
+	Urls    []string          `json:"urls" yaml:"urls"`
+	Method  string            `json:"method" yaml:"method"`
+	Headers map[string]string `json:"headers" yaml:"headers"`
+	Item    string            `json:"item" yaml:"item"`
+	Fields  map[string]string `json:"fields" yaml:"fields"`
+	Columns []string          `json:"columns" yaml:"columns"`
+	Table   string            `json:"table" yaml:"table"`
+	Workers int               `json:"workers" yaml:"workers"`
+}
+
+// LoadJobSpec 加载抓取任务配置, .yaml/.yml 按 YAML 解析, 其他按 JSON 解析
+func LoadJobSpec(path string) (*JobSpec, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	spec := &JobSpec{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, spec)
+	default:
+		err = json.Unmarshal(b, spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// url中的页码范围 如 {1-3}
+var regUrlRange = regexp.MustCompile(`\{(\d+)-(\d+)\}`)
+
+// expandUrl 展开url中的页码范围
+func expandUrl(u string) []string {
+	m := regUrlRange.FindStringSubmatchIndex(u)
+	if m == nil {
+		return []string{u}
+	}
+	start, _ := strconv.Atoi(u[m[2]:m[3]])
+	end, _ := strconv.Atoi(u[m[4]:m[5]])
+	list := make([]string, 0)
+	for i := start; i <= end; i++ {
+		list = append(list, expandUrl(u[:m[0]]+strconv.Itoa(i)+u[m[1]:])...)
+	}
+	return list
+}
+
+// Run 执行抓取任务, 返回提取的数据
+// 提取的数据同时保存在每个任务的 Task.Data["rows"], db 不为nil且配置了 table 时写入该表
+// vs 为 StartJobGet 的可变参数, 如 *http.Client, RetryFunc, FailedFunc
+func (s *JobSpec) Run(db *Mysql, vs ...interface{}) ([]map[string]string, error) {
+	if len(s.Urls) == 0 {
+		return nil, errors.New("spec urls is null.")
+	}
+	if s.Method != "" && strings.ToUpper(s.Method) != "GET" {
+		return nil, errors.New("spec method is not supported : " + s.Method)
+	}
+	if len(s.Fields) == 0 {
+		return nil, errors.New("spec fields is null.")
+	}
+
+	queue := NewQueue()
+	for _, u := range s.Urls {
+		for _, v := range expandUrl(u) {
+			_ = queue.Add(&Task{Url: v, Data: map[string]interface{}{}})
+		}
+	}
+
+	header := http.Header{}
+	for k, v := range s.Headers {
+		header.Set(k, v)
+	}
+
+	var (
+		rows []map[string]string
+		mux  sync.Mutex
+	)
+	succeed := SucceedFunc(func(c *Context) {
+		dom, err := NewGoquery(string(c.RespBody))
+		if err != nil {
+			loger(err)
+			return
+		}
+		list := s.extract(dom)
+		if c.Task != nil {
+			c.Task.Data["rows"] = list
+		}
+		mux.Lock()
+		rows = append(rows, list...)
+		mux.Unlock()
+		if db == nil || s.Table == "" {
+			return
+		}
+		for _, row := range list {
+			data := make(map[string]interface{}, len(row))
+			for k, v := range row {
+				data[k] = v
+			}
+			if err := db.Insert(s.Table, data); err != nil {
+				loger(err)
+			}
+		}
+	})
+
+	workers := s.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if err := StartJobGet(workers, queue, append(vs, succeed, header)...); err != nil {
+		return rows, err
+	}
+	return rows, nil
+}
+
+// extract 按配置提取页面中的数据
+func (s *JobSpec) extract(dom *goquery.Document) []map[string]string {
+	columns := s.Columns
+	if len(columns) == 0 {
+		for k := range s.Fields {
+			columns = append(columns, k)
+		}
+	}
+
+	items := dom.Selection
+	if s.Item != "" {
+		items = dom.Find(s.Item)
+	}
+
+	rows := make([]map[string]string, 0, items.Length())
+	items.Each(func(i int, item *goquery.Selection) {
+		row := make(map[string]string, len(columns))
+		for _, col := range columns {
+			row[col] = selectValue(item, s.Fields[col])
+		}
+		rows = append(rows, row)
+	})
+	return rows
+}
+
+// selectValue 按 "选择器@属性" 取值, 没有属性则取文本
+func selectValue(sel *goquery.Selection, selector string) string {
+	attr := ""
+	if i := strings.LastIndex(selector, "@"); i >= 0 {
+		selector, attr = selector[:i], selector[i+1:]
+	}
+	selector = strings.TrimSpace(selector)
+	if selector != "" {
+		sel = sel.Find(selector)
+	}
+	sel = sel.First()
+	if attr != "" {
+		v, _ := sel.Attr(attr)
+		return strings.TrimSpace(v)
+	}
+	return strings.TrimSpace(sel.Text())
+}
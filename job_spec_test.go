@@ -0,0 +1,66 @@
+package gathertool
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestJobSpec(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "spec" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `<table><tbody>
+			<tr><td>%[1]s-a</td><td><a href="/d/%[1]s-a">详情</a></td></tr>
+			<tr><td>%[1]s-b</td><td><a href="/d/%[1]s-b">详情</a></td></tr>
+		</tbody></table>`, r.URL.Path[len("/list/"):])
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "job.yaml")
+	err = ioutil.WriteFile(path, []byte(`
+urls:
+  - `+ts.URL+`/list/{1-2}
+headers:
+  X-Token: spec
+item: tbody tr
+fields:
+  name: td
+  link: a@href
+workers: 2
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec, err := LoadJobSpec(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := spec.Run(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]string, 0)
+	for _, row := range rows {
+		got = append(got, row["name"]+" "+row["link"])
+	}
+	sort.Strings(got)
+	want := []string{"1-a /d/1-a", "1-b /d/1-b", "2-a /d/2-a", "2-b /d/2-b"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("rows = %v", got)
+	}
+}
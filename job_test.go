@@ -0,0 +1,316 @@
+package gathertool
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStartJobGetProgress(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	queue := NewQueue().(*Queue)
+	for i := 0; i < 10; i++ {
+		_ = queue.Add(&Task{Url: fmt.Sprintf("%s/%d", ts.URL, i)})
+	}
+	if queue.Len() != 10 {
+		t.Fatalf("Len = %d", queue.Len())
+	}
+
+	var (
+		calls    int
+		lastDone int
+		lens     []int
+	)
+	StartJobGet(1, queue, ProgressFunc(func(done, remaining, inflight int) {
+		calls++
+		if done != lastDone+1 || remaining != queue.Len() || inflight != 0 {
+			t.Errorf("progress done=%d remaining=%d inflight=%d", done, remaining, inflight)
+		}
+		lastDone = done
+		lens = append(lens, queue.Len())
+	}))
+
+	if calls != 10 || queue.Len() != 0 {
+		t.Fatalf("calls = %d, Len = %d", calls, queue.Len())
+	}
+	for i := 1; i < len(lens); i++ {
+		if lens[i] >= lens[i-1] {
+			t.Fatalf("Len did not decrease: %v", lens)
+		}
+	}
+}
+
+func TestStartJobGetAbort(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	queue := NewQueue().(*Queue)
+	for i := 0; i < 10; i++ {
+		_ = queue.Add(&Task{Url: fmt.Sprintf("%s/%d", ts.URL, i)})
+	}
+
+	banned := errors.New("account banned")
+	err := StartJobGet(1, queue, SucceedFunc(func(c *Context) {
+		if string(c.RespBody) == "/3" {
+			c.AbortCrawl(banned)
+		}
+	}))
+	if err != banned {
+		t.Fatalf("err = %v", err)
+	}
+	if hits != 4 || queue.Len() != 6 {
+		t.Fatalf("hits = %d, Len = %d", hits, queue.Len())
+	}
+}
+
+func TestStartJobGetHostBudget(t *testing.T) {
+	var a, b int32
+	tsA := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&a, 1)
+	}))
+	defer tsA.Close()
+	tsB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&b, 1)
+	}))
+	defer tsB.Close()
+
+	hostA := tsA.Listener.Addr().String()
+	hostB := tsB.Listener.Addr().String()
+	SetHostBudget(hostA, 3)
+	SetHostBudget(hostB, 3)
+	defer SetHostBudget(hostA, 0)
+	defer SetHostBudget(hostB, 0)
+
+	queue := NewQueue()
+	for i := 0; i < 5; i++ {
+		_ = queue.Add(&Task{Url: fmt.Sprintf("%s/%d", tsA.URL, i)})
+		_ = queue.Add(&Task{Url: fmt.Sprintf("%s/%d", tsB.URL, i)})
+	}
+	if err := StartJobGet(4, queue); err != nil {
+		t.Fatal(err)
+	}
+	if a != 3 || b != 3 {
+		t.Fatalf("host a fetched %d, host b fetched %d", a, b)
+	}
+}
+
+func TestStartJobGetHostBudgetClassifier(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 前两次返回 200 但内容是被拦截的页面
+		if atomic.AddInt32(&hits, 1) <= 2 {
+			fmt.Fprint(w, "blocked")
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+	SetClassifier(func(c *Context) Action {
+		if string(c.RespBody) == "blocked" {
+			return ActionFail
+		}
+		return ActionSuccess
+	})
+	defer SetClassifier(nil)
+
+	host := ts.Listener.Addr().String()
+	SetHostBudget(host, 3)
+	defer SetHostBudget(host, 0)
+
+	queue := NewQueue()
+	for i := 0; i < 6; i++ {
+		_ = queue.Add(&Task{Url: fmt.Sprintf("%s/%d", ts.URL, i)})
+	}
+	if err := StartJobGet(1, queue); err != nil {
+		t.Fatal(err)
+	}
+	// 分类为失败的页面不占用 host 的抓取数量
+	if hits != 5 {
+		t.Fatalf("hits = %d", hits)
+	}
+}
+
+func TestStartJobGetClientFactory(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "direct")
+	}))
+	defer ts.Close()
+
+	proxies := make([]*httptest.Server, 2)
+	for i := range proxies {
+		name := fmt.Sprintf("proxy-%d", i)
+		proxies[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, name)
+		}))
+		defer proxies[i].Close()
+	}
+
+	queue := NewQueue()
+	for i := 0; i < 20; i++ {
+		_ = queue.Add(&Task{Url: fmt.Sprintf("%s/%d", ts.URL, i)})
+	}
+
+	var (
+		mux sync.Mutex
+		got = make(map[int][]string)
+	)
+	err := StartJobGet(2, queue, ClientFactory(func(workerID int) *http.Client {
+		u, _ := url.Parse(proxies[workerID].URL)
+		return &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(u)}}
+	}), SucceedFunc(func(c *Context) {
+		mux.Lock()
+		defer mux.Unlock()
+		got[c.JobNumber] = append(got[c.JobNumber], string(c.RespBody))
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := 0
+	for worker, bodies := range got {
+		for _, b := range bodies {
+			if b != fmt.Sprintf("proxy-%d", worker) {
+				t.Fatalf("worker %d got %q", worker, b)
+			}
+		}
+		total += len(bodies)
+	}
+	if total != 20 {
+		t.Fatalf("total = %d", total)
+	}
+}
+
+func TestStartJobGetClientRedirectLoop(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/a" {
+			http.Redirect(w, r, "/b", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/a", http.StatusFound)
+	}))
+	defer ts.Close()
+
+	queue := NewQueue()
+	_ = queue.Add(&Task{Url: ts.URL + "/a"})
+	var loopErr error
+	// worker 的 Client 同样检查重定向循环
+	err := StartJobGet(1, queue, ClientFactory(func(workerID int) *http.Client {
+		return &http.Client{}
+	}), FailedFunc(func(c *Context) {
+		loopErr = c.Err
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(loopErr, ErrRedirectLoop) {
+		t.Fatalf("err = %v", loopErr)
+	}
+}
+
+func TestStartJobGetCheckpoint(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	queue := NewQueue()
+	for i := 0; i < 10; i++ {
+		_ = queue.Add(&Task{Url: fmt.Sprintf("%s/%d", ts.URL, i)})
+	}
+
+	var got []string
+	err := StartJobGet(1, queue, Checkpoint(3, func(stats Stats, remaining int) {
+		got = append(got, fmt.Sprintf("%d/%d/%d", stats.Count, stats.Code[200], remaining))
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"3/3/7", "6/6/4", "9/9/1"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("checkpoints = %v, want %v", got, want)
+	}
+}
+
+func TestStartJobGetSlowCheckpoint(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer ts.Close()
+
+	queue := NewQueue()
+	for i := 0; i < 10; i++ {
+		_ = queue.Add(&Task{Url: fmt.Sprintf("%s/%d", ts.URL, i)})
+	}
+
+	// 检查点阻塞时并发继续执行任务, 任务结束前执行完所有的检查点
+	release := make(chan struct{})
+	var calls int32
+	done := make(chan error)
+	go func() {
+		done <- StartJobGet(2, queue, Checkpoint(1, func(stats Stats, remaining int) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-release
+			}
+		}))
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&hits) < 10 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&hits); n != 10 {
+		t.Fatalf("hits = %d while checkpoint is blocked", n)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 10 {
+		t.Fatalf("checkpoint calls = %d", n)
+	}
+}
+
+func TestStartJobGetRecover(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	queue := NewQueue()
+	for i := 0; i < 10; i++ {
+		_ = queue.Add(&Task{Url: fmt.Sprintf("%s/%d", ts.URL, i)})
+	}
+
+	var succeed, failed int32
+	err := StartJobGet(2, queue, SucceedFunc(func(c *Context) {
+		if string(c.RespBody) == "/3" || string(c.RespBody) == "/7" {
+			panic("bad page")
+		}
+		atomic.AddInt32(&succeed, 1)
+	}), FailedFunc(func(c *Context) {
+		if c.Err == nil {
+			t.Error("Err is nil after panic")
+		}
+		atomic.AddInt32(&failed, 1)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if succeed != 8 || failed != 2 {
+		t.Fatalf("succeed = %d, failed = %d", succeed, failed)
+	}
+}
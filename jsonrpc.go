@@ -0,0 +1,80 @@
+/*
+	Description : JSON-RPC 2.0 请求
+	Author : ManGe
+	Version : v0.1
+	Date : 2021-04-29
+*/
+
+package gathertool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// JSON-RPC 请求的id, 递增分配
+var jsonRPCId int64
+
+// JSON-RPC 请求体
+type jsonRPCRequest struct {
+	JsonRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+	Id      int64       `json:"id"`
+}
+
+// JSON-RPC 响应体
+type jsonRPCResponse struct {
+	JsonRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   *JSONRPCError   `json:"error"`
+	Id      interface{}     `json:"id"`
+}
+
+// JSONRPCError JSON-RPC 响应中的错误
+type JSONRPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *JSONRPCError) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// JSONRPC 创建 JSON-RPC 2.0 请求, vs 与 Get 相同
+func JSONRPC(url, method string, params interface{}, vs ...interface{}) (*Context, error) {
+	body, err := json.Marshal(&jsonRPCRequest{
+		JsonRPC: "2.0",
+		Method:  method,
+		Params:  params,
+		Id:      atomic.AddInt64(&jsonRPCId, 1),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return PostJson(url, string(body), vs...)
+}
+
+// JSONRPCResult 解析 JSON-RPC 响应, result 写入 v; 响应中含有 error 时返回 *JSONRPCError
+func (c *Context) JSONRPCResult(v interface{}) error {
+	if c.RespBody == nil {
+		if c.Err != nil {
+			return c.Err
+		}
+		return errors.New("Response body is nil")
+	}
+	resp := &jsonRPCResponse{}
+	if err := json.Unmarshal(c.RespBody, resp); err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if v == nil || len(resp.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, v)
+}
@@ -0,0 +1,52 @@
+package gathertool
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJSONRPC(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &jsonRPCRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.JsonRPC != "2.0" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch req.Method {
+		case "add":
+			var params []int
+			b, _ := json.Marshal(req.Params)
+			_ = json.Unmarshal(b, &params)
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","result":%d,"id":%d}`, params[0]+params[1], req.Id)
+		default:
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":%d}`, req.Id)
+		}
+	}))
+	defer ts.Close()
+
+	c, err := JSONRPC(ts.URL, "add", []int{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	var sum int
+	if err := c.JSONRPCResult(&sum); err != nil {
+		t.Fatal(err)
+	}
+	if sum != 3 {
+		t.Fatalf("sum = %d", sum)
+	}
+
+	c, err = JSONRPC(ts.URL, "sub", []int{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	err = c.JSONRPCResult(&sum)
+	if rpcErr, ok := err.(*JSONRPCError); !ok || rpcErr.Code != -32601 {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package gathertool
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter 限速, 每 interval 放行一次
+type rateLimiter struct {
+	mux      sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newRateLimiter 每秒放行 perSecond 次, perSecond <= 0 返回 nil 表示不限速
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// Wait 等待直到放行
+func (r *rateLimiter) Wait() {
+	if r == nil {
+		return
+	}
+	r.mux.Lock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	wait := r.next.Sub(now)
+	r.next = r.next.Add(r.interval)
+	r.mux.Unlock()
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// bandwidthReader 限速读取, 每秒最多读取 rate 字节
+type bandwidthReader struct {
+	r     io.Reader
+	rate  int64
+	start time.Time
+	sum   int64
+}
+
+// newBandwidthReader 限速读取, rate <= 0 不限速
+func newBandwidthReader(r io.Reader, rate int64) io.Reader {
+	if rate <= 0 {
+		return r
+	}
+	return &bandwidthReader{r: r, rate: rate}
+}
+
+// Read 每次最多读取 0.1 秒的量, 读取的总量超过已用时间允许的量时等待
+func (b *bandwidthReader) Read(p []byte) (int, error) {
+	if b.start.IsZero() {
+		b.start = time.Now()
+	}
+	chunk := b.rate / 10
+	if chunk < 1 {
+		chunk = 1
+	}
+	if int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+	n, err := b.r.Read(p)
+	b.sum += int64(n)
+	expect := time.Duration(float64(b.sum) / float64(b.rate) * float64(time.Second))
+	if wait := expect - time.Since(b.start); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
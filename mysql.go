@@ -1,14 +1,21 @@
 package gathertool
 
 import (
+	"bufio"
 	"bytes"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
+	"go/format"
+	"io"
 	"log"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 
@@ -24,6 +31,13 @@ type Mysql struct {
 	MaxIdleConn int
 	DB *sql.DB
 	Log bool
+
+	// 写入限速
+	writeLimiter *rateLimiter
+
+	// 连接失败的重试次数与第一次重试的间隔, 见 SetConnRetry
+	connRetry    int
+	connInterval time.Duration
 }
 
 func NewMysqlDB(host string,port int, user, password, database string)(err error){
@@ -54,8 +68,78 @@ func (m *Mysql) CloseLog(){
 	m.Log = false
 }
 
+// SetWriteRate 设置写入限速, 每秒最多执行 perSecond 次写入, <= 0 不限速
+// Insert、InsertBatch(包括 BufferedInserter) 每条语句计一次写入, 与请求的速度无关
+func (m *Mysql) SetWriteRate(perSecond float64) {
+	m.writeLimiter = newRateLimiter(perSecond)
+}
+
+// Validate 检查连接配置: host与user、database不能为空, port在1-65535之间
+// 返回所有不合法的配置, 可在 Conn 之前调用以得到比连接失败更明确的错误
+func (m *Mysql) Validate() error {
+	list := make([]string, 0)
+	if m.Host == "" {
+		list = append(list, "host is null")
+	}
+	if m.Port < 1 || m.Port > 65535 {
+		list = append(list, fmt.Sprintf("port %d is out of range 1-65535", m.Port))
+	}
+	if m.User == "" {
+		list = append(list, "user is null")
+	}
+	if m.DataBase == "" {
+		list = append(list, "database is null")
+	}
+	if len(list) > 0 {
+		return errors.New("mysql config is bad: " + strings.Join(list, "; "))
+	}
+	return nil
+}
+
+// SetConnRetry 设置 Conn 连接失败后的重试, 用于启动时数据库还不可用(如容器编排)
+// 设置后 Conn 会 Ping 数据库, 失败则等待后重试, 等待时间从 interval 开始每次翻倍, 最长30秒
+func (m *Mysql) SetConnRetry(attempts int, interval time.Duration) {
+	m.connRetry = attempts
+	m.connInterval = interval
+}
+
 // 连接mysql
 func (m *Mysql) Conn() (err error){
+	if m.connRetry < 1 {
+		return m.conn()
+	}
+	return retryConn(m.connRetry, m.connInterval, m.Log, func() error {
+		if err := m.conn(); err != nil {
+			return err
+		}
+		if err := m.DB.Ping(); err != nil {
+			_ = m.DB.Close()
+			return err
+		}
+		return nil
+	})
+}
+
+// retryConn 执行 try, 失败后等待 interval 再重试, 最多重试 attempts 次, 等待时间每次翻倍, 最长30秒
+func retryConn(attempts int, interval time.Duration, logFail bool, try func() error) error {
+	for i := 0; ; i++ {
+		err := try()
+		if err == nil || i >= attempts {
+			return err
+		}
+		if logFail {
+			log.Println("[Sql] Conn Fail : ", err, ", ", interval, "后重试")
+		}
+		time.Sleep(interval)
+		interval *= 2
+		if interval > 30*time.Second {
+			interval = 30*time.Second
+		}
+	}
+}
+
+// conn 打开数据库, 不检查连接是否可用
+func (m *Mysql) conn() (err error){
 	m.DB, err = sql.Open("mysql", fmt.Sprintf("%s:%s@%s(%s:%d)/%s",
 		m.User, m.Password, "tcp", m.Host, m.Port, m.DataBase))
 	if err != nil {
@@ -114,7 +198,7 @@ func (m *Mysql) Describe(table string) (map[string]string, error){
 		if strings.Contains(result.Type, "varchar") || strings.Contains(result.Type, "text"){
 			fiedlType = "string"
 		}
-		if strings.Contains(result.Type, "float") || strings.Contains(result.Type, "doble") {
+		if strings.Contains(result.Type, "float") || strings.Contains(result.Type, "double") || strings.Contains(result.Type, "decimal") {
 			fiedlType = "float"
 		}
 		if strings.Contains(result.Type, "blob")  {
@@ -129,6 +213,223 @@ func (m *Mysql) Describe(table string) (map[string]string, error){
 	return fieldMap, nil
 }
 
+// ColumnTypes 获取表中字段的mysql类型, 如 "varchar(100)"、"text", 与 Describe 不同不做转换
+func (m *Mysql) ColumnTypes(table string) (map[string]string, error) {
+	if m.DB == nil{
+		_=m.Conn()
+	}
+	if !isSqlName(table) {
+		return nil, fmt.Errorf("bad table name %q", table)
+	}
+	rows, err := m.DB.Query("DESCRIBE " + table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := make(map[string]string)
+	for rows.Next() {
+		result := &TableInfo{}
+		if err := rows.Scan(&result.Field, &result.Type, &result.Null, &result.Key, &result.Default, &result.Extra); err != nil {
+			return nil, err
+		}
+		columns[result.Field] = strings.ToLower(result.Type)
+	}
+	return columns, rows.Err()
+}
+
+// text 类型的最大字节数
+var textColumnBytes = map[string]int64{
+	"tinytext": 255,
+	"text": 65535,
+	"mediumtext": 16777215,
+	"longtext": 4294967295,
+}
+
+// TruncateForColumn 按字段类型的长度截断字符串, 避免写入时被mysql截断或报错(strict模式)
+// char(n)、varchar(n) 按字符数截断, text 类型按字节数截断且不会截断半个字符; 其他类型原样返回
+// colType 为 mysql 的类型, 见 Mysql.ColumnTypes
+func TruncateForColumn(value string, colType string) string {
+	colType = strings.ToLower(strings.TrimSpace(colType))
+	if max, ok := textColumnBytes[colType]; ok {
+		if int64(len(value)) <= max {
+			return value
+		}
+		value = value[:max]
+		// 去掉被截断的半个字符
+		for len(value) > 0 {
+			r, size := utf8.DecodeLastRuneInString(value)
+			if r != utf8.RuneError || size > 1 {
+				break
+			}
+			value = value[:len(value)-1]
+		}
+		return value
+	}
+	if !strings.HasPrefix(colType, "varchar(") && !strings.HasPrefix(colType, "char(") {
+		return value
+	}
+	start, end := strings.Index(colType, "("), strings.Index(colType, ")")
+	if end < start {
+		return value
+	}
+	max, err := strconv.Atoi(colType[start+1 : end])
+	if err != nil || utf8.RuneCountInString(value) <= max {
+		return value
+	}
+	return string([]rune(value)[:max])
+}
+
+// DescribeAll 获取数据库中所有表的结构, 表名 -> 字段 -> 字段类型, 字段类型见 Describe
+func (m *Mysql) DescribeAll() (map[string]map[string]string, error) {
+	if m.DB == nil{
+		_=m.Conn()
+	}
+	rows, err := m.DB.Query("SHOW TABLES")
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]string, 0)
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	schema := make(map[string]map[string]string, len(tables))
+	for _, table := range tables {
+		fields, err := m.Describe(table)
+		if err != nil {
+			return nil, err
+		}
+		schema[table] = fields
+	}
+	return schema, nil
+}
+
+// GenerateStructs 根据表结构生成Go结构体代码, 表与字段按名称排序, 字段带 json 与 db tag
+// schema 为 DescribeAll 的返回, pkg 为生成代码的包名
+func GenerateStructs(schema map[string]map[string]string, pkg string) string {
+	tables := make([]string, 0, len(schema))
+	useTime := false
+	for table, fields := range schema {
+		tables = append(tables, table)
+		for _, t := range fields {
+			if t == "time" {
+				useTime = true
+			}
+		}
+	}
+	sort.Strings(tables)
+
+	var buf bytes.Buffer
+	buf.WriteString("package " + pkg + "\n\n")
+	if useTime {
+		buf.WriteString("import \"time\"\n\n")
+	}
+	for _, table := range tables {
+		fields := make([]string, 0, len(schema[table]))
+		for field := range schema[table] {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		buf.WriteString(fmt.Sprintf("// %s 表 %s\n", camelName(table), table))
+		buf.WriteString("type " + camelName(table) + " struct {\n")
+		for _, field := range fields {
+			buf.WriteString(fmt.Sprintf("\t%s %s `json:\"%s\" db:\"%s\"`\n", camelName(field), fieldGoType(schema[table][field]), field, field))
+		}
+		buf.WriteString("}\n\n")
+	}
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return buf.String()
+	}
+	return string(code)
+}
+
+// fieldGoType Describe 的字段类型对应的Go类型
+func fieldGoType(t string) string {
+	switch t {
+	case "int":
+		return "int64"
+	case "float":
+		return "float64"
+	case "[]byte":
+		return "[]byte"
+	case "time":
+		return "time.Time"
+	}
+	return "string"
+}
+
+// camelName 下划线命名转为驼峰命名, 如 ip_list -> IpList, id -> ID
+func camelName(name string) string {
+	var buf strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	}) {
+		if strings.ToLower(part) == "id" {
+			buf.WriteString("ID")
+			continue
+		}
+		buf.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	s := buf.String()
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		s = "T" + s
+	}
+	return s
+}
+
+// ColumnExists 表中是否存在字段
+func (m *Mysql) ColumnExists(table, column string) (bool, error) {
+	fields, err := m.Describe(table)
+	if err != nil {
+		return false, err
+	}
+	_, ok := fields[column]
+	return ok, nil
+}
+
+// AddColumn 给表新增字段, 字段已存在则不做处理
+// typ 可以是 Describe 的字段类型(int/string/float/time/[]byte)或mysql的类型, 如 "varchar(100)"
+func (m *Mysql) AddColumn(table, column, typ string) error {
+	if !isSqlName(table) || !isSqlName(column) {
+		return errors.New("table or column name is bad.")
+	}
+	if typ == "" {
+		return errors.New("column type is null.")
+	}
+	ok, err := m.ColumnExists(table, column)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+	return m.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + fieldSqlType(typ))
+}
+
+// isSqlName 是否是合法的表名或字段名, 只允许字母数字与下划线
+func isSqlName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
 // Select 查询语句 返回 map
 func (m *Mysql) Select(sql string) ([]map[string]string, error) {
 	if m.DB == nil{
@@ -172,6 +473,82 @@ func (m *Mysql) Select(sql string) ([]map[string]string, error) {
 	return list, nil
 }
 
+// SelectJSON 查询并将结果以json数组写入 w, 每行为 {"字段": "值"}, NULL 为 null
+// 逐行写入不会把所有结果读到内存, 用于导出大量数据
+func (m *Mysql) SelectJSON(sql string, w io.Writer) error {
+	if m.DB == nil{
+		_=m.Conn()
+	}
+	rows, err := m.DB.Query(sql)
+	if m.Log{
+		log.Println("[Sql] Exec : " + sql)
+		if err != nil{
+			log.Println("[Sql] Error : " + err.Error())
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	return writeRowsJSON(rows, w)
+}
+
+// sqlRows *sql.Rows 的方法, 便于测试
+type sqlRows interface {
+	Columns() ([]string, error)
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+}
+
+// writeRowsJSON 逐行将查询结果写为json数组
+func writeRowsJSON(rows sqlRows, w io.Writer) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	if _, err := bw.WriteString("["); err != nil {
+		return err
+	}
+	item := make(map[string]interface{}, len(columns))
+	for n := 0; rows.Next(); n++ {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, column := range columns {
+			if values[i] == nil {
+				item[column] = nil
+			} else {
+				item[column] = string(values[i])
+			}
+		}
+		if n > 0 {
+			if _, err := bw.WriteString(","); err != nil {
+				return err
+			}
+		}
+		// Encode 会在末尾写入换行
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if _, err := bw.WriteString("]"); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
 // 从select语句获取 table name
 func (m *Mysql) selectGetTable(sql string) string{
 	tList := strings.Split(sql,"from ")
@@ -184,6 +561,72 @@ func (m *Mysql) selectGetTable(sql string) string{
 	return ""
 }
 
+// 字段类型对应创建表使用的类型
+var fieldTypeSql = map[string]string{
+	"int": "int(11)",
+	"string": "text",
+	"float": "double",
+	"time": "datetime",
+	"[]byte": "blob",
+}
+
+// fieldSqlType 字段类型转换为创建表使用的类型, 非 Describe 的字段类型则原样返回
+func fieldSqlType(t string) string {
+	if v, ok := fieldTypeSql[t]; ok {
+		return v
+	}
+	return t
+}
+
+// InferSchema 根据抓取的数据推断表结构, 返回的字段类型与 Describe 一致(int/string/float/time/[]byte)
+// 可直接用于 NewTable; 同一字段类型不一致时 int 与 float 合并为 float, 其他情况合并为 string
+func InferSchema(records []map[string]interface{}) map[string]string {
+	schema := make(map[string]string)
+	for _, record := range records {
+		for k, v := range record {
+			t := valueFieldType(v)
+			if t == "" {
+				continue
+			}
+			old, ok := schema[k]
+			switch {
+			case !ok || old == t:
+				schema[k] = t
+			case (old == "int" && t == "float") || (old == "float" && t == "int"):
+				schema[k] = "float"
+			default:
+				schema[k] = "string"
+			}
+		}
+	}
+	// 全部为空值的字段
+	for _, record := range records {
+		for k := range record {
+			if _, ok := schema[k]; !ok {
+				schema[k] = "string"
+			}
+		}
+	}
+	return schema
+}
+
+// valueFieldType 值对应的字段类型, nil 返回空
+func valueFieldType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return ""
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, bool:
+		return "int"
+	case float32, float64:
+		return "float"
+	case time.Time, *time.Time:
+		return "time"
+	case []byte:
+		return "[]byte"
+	}
+	return "string"
+}
+
 // NewTable 创建表
 func (m *Mysql) NewTable(table string, fields map[string]string) error {
 	var (
@@ -207,7 +650,7 @@ func (m *Mysql) NewTable(table string, fields map[string]string) error {
 	for k,v := range fields{
 		createSql.WriteString(k)
 		createSql.WriteString(" ")
-		createSql.WriteString(v)
+		createSql.WriteString(fieldSqlType(v))
 		createSql.WriteString(", ")
 	}
 	createSql.WriteString("PRIMARY KEY (id) ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;")
@@ -228,7 +671,7 @@ func (m *Mysql) Insert(table string, fieldData map[string]interface{}) error {
 		fieldSql bytes.Buffer
 		valueSql bytes.Buffer
 		line = len(fieldData)
-		n = 0
+		args = make([]interface{}, 0, line)
 	)
 
 	if table == ""{
@@ -245,21 +688,23 @@ func (m *Mysql) Insert(table string, fieldData map[string]interface{}) error {
 	insertSql.WriteString(table)
 	fieldSql.WriteString(" (")
 	valueSql.WriteString(" (")
+	// 字段与值在同一个循环中添加, 保证顺序一致, 值通过占位符传入由驱动转义
  	for k,v := range fieldData {
-		fieldSql.WriteString(k)
-		valueSql.WriteString(StringValue(v))
-		n++
-		if n < line{
+		if len(args) > 0 {
 			fieldSql.WriteString(", ")
 			valueSql.WriteString(", ")
 		}
+		fieldSql.WriteString(k)
+		valueSql.WriteString("?")
+		args = append(args, v)
 	}
 
 	insertSql.WriteString(fieldSql.String())
 	insertSql.WriteString(") VALUES ")
 	insertSql.WriteString(valueSql.String())
 	insertSql.WriteString(");")
-	_, err := m.DB.Exec(insertSql.String())
+	m.writeLimiter.Wait()
+	_, err := m.DB.Exec(insertSql.String(), args...)
 	if m.Log{
 		loger("[Sql] Exec : " + insertSql.String())
 		if err != nil{
@@ -270,6 +715,76 @@ func (m *Mysql) Insert(table string, fieldData map[string]interface{}) error {
  	return err
 }
 
+// InsertBatch 批量新增数据, 一条 insert 语句写入多行
+// 字段取所有数据的字段并集, 缺少的字段写入 NULL
+func (m *Mysql) InsertBatch(table string, fieldDataList []map[string]interface{}) error {
+	return m.writeRows("insert", table, fieldDataList)
+}
+
+// Replace 使用 REPLACE INTO 写入一行, 用于按唯一键保存最新的数据
+// 与 INSERT ... ON DUPLICATE KEY UPDATE 不同, 主键或唯一键冲突时先删除旧行再插入新行:
+// 未传入的字段会变为默认值而不是保留旧值, AUTO_INCREMENT 的主键会变为新的值, 删除会触发外键的级联操作
+func (m *Mysql) Replace(table string, fieldData map[string]interface{}) error {
+	return m.writeRows("replace", table, []map[string]interface{}{fieldData})
+}
+
+// writeRows 参数化的 insert/replace 语句写入多行
+func (m *Mysql) writeRows(verb, table string, fieldDataList []map[string]interface{}) error {
+	if table == ""{
+		return errors.New("table is null")
+	}
+	if len(fieldDataList) < 1{
+		return errors.New("data len is 0")
+	}
+	if m.DB == nil{
+		_=m.Conn()
+	}
+
+	fieldMap := make(map[string]struct{})
+	for _, fieldData := range fieldDataList {
+		for k := range fieldData {
+			fieldMap[k] = struct{}{}
+		}
+	}
+	if len(fieldMap) < 1{
+		return errors.New("fiedls len is 0")
+	}
+	fields := make([]string, 0, len(fieldMap))
+	for k := range fieldMap {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+
+	var insertSql bytes.Buffer
+	args := make([]interface{}, 0, len(fields)*len(fieldDataList))
+	value := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(fields)), ", ") + ")"
+	insertSql.WriteString(verb + " ")
+	insertSql.WriteString(table)
+	insertSql.WriteString(" (")
+	insertSql.WriteString(strings.Join(fields, ", "))
+	insertSql.WriteString(") VALUES ")
+	for i, fieldData := range fieldDataList {
+		if i > 0 {
+			insertSql.WriteString(", ")
+		}
+		insertSql.WriteString(value)
+		for _, k := range fields {
+			args = append(args, fieldData[k])
+		}
+	}
+	insertSql.WriteString(";")
+
+	m.writeLimiter.Wait()
+	_, err := m.DB.Exec(insertSql.String(), args...)
+	if m.Log{
+		loger("[Sql] Exec : " + insertSql.String())
+		if err != nil{
+			loger("[Sql] Error : " + err.Error())
+		}
+	}
+	return err
+}
+
 // 执行 Update
 func (m *Mysql) Update(sql string) error {
 	_, err := m.DB.Exec(sql)
@@ -294,6 +809,100 @@ func (m *Mysql) Exec(sql string) error {
 	return err
 }
 
+// ExecMany 按顺序执行多条sql, 遇到错误停止并返回错误
+// tx 为 true 时在一个事务中执行, 出错回滚(注意 mysql 的 DDL 语句会隐式提交, 无法回滚)
+func (m *Mysql) ExecMany(statements []string, tx bool) error {
+	if m.DB == nil{
+		_=m.Conn()
+	}
+	if !tx {
+		for _, statement := range statements {
+			if err := m.Exec(statement); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	t, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		_, err := t.Exec(statement)
+		if m.Log{
+			loger("[Sql] Exec : " + statement)
+		}
+		if err != nil {
+			if m.Log{
+				loger("[Sql] Error : " + err.Error())
+			}
+			_ = t.Rollback()
+			return err
+		}
+	}
+	return t.Commit()
+}
+
+// ExecScript 执行多条以分号分隔的sql, 见 SplitSqlScript 与 ExecMany
+func (m *Mysql) ExecScript(script string, tx bool) error {
+	return m.ExecMany(SplitSqlScript(script), tx)
+}
+
+// SplitSqlScript 将以分号分隔的sql脚本拆分为多条语句
+// 引号('、"、`)中的分号不拆分, 去除 -- 、# 与 /* */ 注释和空语句
+func SplitSqlScript(script string) []string {
+	var (
+		list  = make([]string, 0)
+		buf   strings.Builder
+		quote rune
+		runes = []rune(script)
+	)
+	add := func() {
+		if v := strings.TrimSpace(buf.String()); v != "" {
+			list = append(list, v)
+		}
+		buf.Reset()
+	}
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if quote != 0 {
+			buf.WriteRune(r)
+			if r == '\\' && quote != '`' && i+1 < len(runes) {
+				i++
+				buf.WriteRune(runes[i])
+			} else if r == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch {
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+			buf.WriteRune(r)
+		case r == ';':
+			add()
+		case r == '#' || (r == '-' && i+2 < len(runes) && runes[i+1] == '-' && (runes[i+2] == ' ' || runes[i+2] == '\t')):
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			buf.WriteRune('\n')
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			end := strings.Index(string(runes[i+2:]), "*/")
+			if end < 0 {
+				i = len(runes)
+			} else {
+				i += 2 + len([]rune(string(runes[i+2:])[:end])) + 1
+			}
+			buf.WriteRune(' ')
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	add()
+	return list
+}
+
 // Delete
 func (m *Mysql) Delete(sql string) error {
 	_, err := m.DB.Exec(sql)
@@ -0,0 +1,175 @@
+package gathertool
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// BufferedInserter 缓冲写入, 数据累积到 flushEvery 条或每隔 flushInterval 通过 InsertBatch 写入一次
+// 可以被多个并发任务同时使用
+type BufferedInserter struct {
+	table         string
+	flushEvery    int
+	flushInterval time.Duration
+
+	mux  *sync.Mutex
+	rows []map[string]interface{}
+
+	// 写入方法, 默认为 Mysql.InsertBatch
+	insert func(table string, rows []map[string]interface{}) error
+
+	// 超长字符串的处理方式与获取字段类型的方法, 默认为 Mysql.ColumnTypes
+	oversize    OversizeMode
+	columnTypes func(table string) (map[string]string, error)
+	columns     map[string]string
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewBufferedInserter 新建缓冲写入
+// flushEvery < 1 时只按时间写入, flushInterval <= 0 时只按数量写入
+func (m *Mysql) NewBufferedInserter(table string, flushEvery int, flushInterval time.Duration) *BufferedInserter {
+	b := newBufferedInserter(table, flushEvery, flushInterval, m.InsertBatch)
+	b.columnTypes = m.ColumnTypes
+	return b
+}
+
+func newBufferedInserter(table string, flushEvery int, flushInterval time.Duration,
+	insert func(table string, rows []map[string]interface{}) error) *BufferedInserter {
+	b := &BufferedInserter{
+		table:         table,
+		flushEvery:    flushEvery,
+		flushInterval: flushInterval,
+		mux:           &sync.Mutex{},
+		insert:        insert,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// run 按时间间隔写入
+func (b *BufferedInserter) run() {
+	defer close(b.done)
+	if b.flushInterval <= 0 {
+		<-b.stop
+		return
+	}
+	ticker := time.NewTicker(b.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.Flush(); err != nil {
+				log.Println("[Sql] Flush Error : " + err.Error())
+			}
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Add 添加一条数据, 达到 flushEvery 条时写入
+func (b *BufferedInserter) Add(fieldData map[string]interface{}) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	fieldData, err := b.checkOversize(fieldData)
+	if err != nil {
+		return err
+	}
+	b.rows = append(b.rows, fieldData)
+	if b.flushEvery > 0 && len(b.rows) >= b.flushEvery {
+		return b.flush()
+	}
+	return nil
+}
+
+// Flush 写入缓冲中的数据, 写入失败时数据保留在缓冲中, 下次写入时重试
+func (b *BufferedInserter) Flush() error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.flush()
+}
+
+func (b *BufferedInserter) flush() error {
+	if len(b.rows) == 0 {
+		return nil
+	}
+	if err := b.insert(b.table, b.rows); err != nil {
+		return err
+	}
+	b.rows = nil
+	return nil
+}
+
+// Close 停止按时间写入并写入剩余的数据
+func (b *BufferedInserter) Close() error {
+	b.once.Do(func() {
+		close(b.stop)
+	})
+	<-b.done
+	return b.Flush()
+}
+
+// 超过字段长度的字符串的处理方式, 见 BufferedInserter.SetOversize
+type OversizeMode int
+
+const (
+	OversizeIgnore   OversizeMode = iota // 不处理, 由mysql截断或报错(strict模式)
+	OversizeTruncate                     // 按字段长度截断
+	OversizeError                        // Add 返回错误, 数据不写入
+)
+
+// SetOversize 设置超过字段长度的字符串的处理方式, 字段类型通过 Mysql.ColumnTypes 获取一次
+// 只检查 char、varchar 与 text 类型的字段, 见 TruncateForColumn
+func (b *BufferedInserter) SetOversize(mode OversizeMode) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.oversize = mode
+}
+
+// checkOversize 按设置截断超长的字符串或返回错误, 截断时复制数据不修改传入的map
+func (b *BufferedInserter) checkOversize(fieldData map[string]interface{}) (map[string]interface{}, error) {
+	if b.oversize == OversizeIgnore || b.columnTypes == nil {
+		return fieldData, nil
+	}
+	if b.columns == nil {
+		columns, err := b.columnTypes(b.table)
+		if err != nil {
+			return nil, err
+		}
+		b.columns = columns
+	}
+	data, copied := fieldData, false
+	for k, v := range fieldData {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		colType, ok := b.columns[k]
+		if !ok {
+			continue
+		}
+		t := TruncateForColumn(s, colType)
+		if t == s {
+			continue
+		}
+		if b.oversize == OversizeError {
+			return nil, fmt.Errorf("field %s : value is too long for %s", k, colType)
+		}
+		if !copied {
+			data = make(map[string]interface{}, len(fieldData))
+			for kk, vv := range fieldData {
+				data[kk] = vv
+			}
+			copied = true
+		}
+		data[k] = t
+	}
+	return data, nil
+}
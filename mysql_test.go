@@ -1,7 +1,17 @@
 package gathertool
 
 import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestConn(t *testing.T){
@@ -37,4 +47,496 @@ func TestConn(t *testing.T){
 	//	"txt": "texasdasdasdasdasdasdasdsaddt",
 	//})
 
-}
\ No newline at end of file
+}
+
+func TestInferSchema(t *testing.T){
+	schema := InferSchema([]map[string]interface{}{
+		{"name": "mange", "age": 22, "score": 1, "data": []byte("a"), "ctime": time.Now(), "note": nil},
+		{"name": "mange2", "age": 23, "score": 1.5, "data": "b", "ctime": time.Now(), "note": nil},
+	})
+	want := map[string]string{
+		"name": "string",
+		"age": "int",
+		"score": "float",
+		"data": "string",
+		"ctime": "time",
+		"note": "string",
+	}
+	for k, v := range want {
+		if schema[k] != v {
+			t.Fatalf("schema[%s] = %s, want %s", k, schema[k], v)
+		}
+	}
+	if len(schema) != len(want) {
+		t.Fatalf("schema = %v", schema)
+	}
+	if fieldSqlType(schema["age"]) != "int(11)" || fieldSqlType("varchar(100)") != "varchar(100)" {
+		t.Fatal("fieldSqlType")
+	}
+}
+
+func TestBufferedInserter(t *testing.T){
+	var (
+		mux sync.Mutex
+		batches []int
+	)
+	insert := func(table string, rows []map[string]interface{}) error {
+		mux.Lock()
+		defer mux.Unlock()
+		batches = append(batches, len(rows))
+		return nil
+	}
+	getBatches := func() []int {
+		mux.Lock()
+		defer mux.Unlock()
+		return append([]int{}, batches...)
+	}
+
+	b := newBufferedInserter("test", 3, 50*time.Millisecond, insert)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_ = b.Add(map[string]interface{}{"id": i})
+		}(i)
+	}
+	wg.Wait()
+	if got := getBatches(); len(got) != 1 || got[0] != 3 {
+		t.Fatalf("flush on count: %v", got)
+	}
+
+	_ = b.Add(map[string]interface{}{"id": 4})
+	time.Sleep(120 * time.Millisecond)
+	if got := getBatches(); len(got) != 2 || got[1] != 1 {
+		t.Fatalf("flush on interval: %v", got)
+	}
+
+	_ = b.Add(map[string]interface{}{"id": 5})
+	_ = b.Close()
+	if got := getBatches(); len(got) != 3 || got[2] != 1 {
+		t.Fatalf("flush on close: %v", got)
+	}
+}
+
+func TestBufferedInserterInsertFailed(t *testing.T){
+	var (
+		fail = true
+		written []map[string]interface{}
+	)
+	b := newBufferedInserter("test", 2, 0, func(table string, rows []map[string]interface{}) error {
+		if fail {
+			return errors.New("insert failed")
+		}
+		written = append(written, rows...)
+		return nil
+	})
+	_ = b.Add(map[string]interface{}{"id": 1})
+	if err := b.Add(map[string]interface{}{"id": 2}); err == nil {
+		t.Fatal("expected insert error")
+	}
+
+	// 写入失败的数据保留, 下次写入时一起写入
+	fail = false
+	_ = b.Add(map[string]interface{}{"id": 3})
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 3 {
+		t.Fatalf("written = %v", written)
+	}
+}
+
+func TestSetWriteRate(t *testing.T){
+	m := &Mysql{}
+	m.SetWriteRate(20)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		m.writeLimiter.Wait()
+	}
+	// 第一次立即放行, 之后每次间隔 50ms
+	if d := time.Since(start); d < 190*time.Millisecond || d > 400*time.Millisecond {
+		t.Fatalf("5 writes took %v", d)
+	}
+
+	m.SetWriteRate(0)
+	start = time.Now()
+	for i := 0; i < 100; i++ {
+		m.writeLimiter.Wait()
+	}
+	if d := time.Since(start); d > 10*time.Millisecond {
+		t.Fatalf("unlimited writes took %v", d)
+	}
+}
+
+func TestMysqlValidate(t *testing.T){
+	db, err := NewMysql("127.0.0.1", 3306, "root", "root123", "spider")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Port = 70000
+	db.DataBase = ""
+	err = db.Validate()
+	if err == nil {
+		t.Fatal("expected validate error")
+	}
+	if !strings.Contains(err.Error(), "port 70000") || !strings.Contains(err.Error(), "database is null") {
+		t.Fatalf("err = %v", err)
+	}
+	if strings.Contains(err.Error(), "user") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+// testMysql 测试用的数据库, 需要设置环境变量 GATHERTOOL_TEST_MYSQL 为 "host:port:user:password:database"
+func testMysql(t *testing.T) *Mysql {
+	cfg := strings.Split(os.Getenv("GATHERTOOL_TEST_MYSQL"), ":")
+	if len(cfg) != 5 {
+		t.Skip("GATHERTOOL_TEST_MYSQL is not set")
+	}
+	port, _ := strconv.Atoi(cfg[1])
+	db, err := NewMysql(cfg[0], port, cfg[2], cfg[3], cfg[4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Conn(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestAddColumn(t *testing.T){
+	if err := (&Mysql{}).AddColumn("test; DROP TABLE test", "name", "string"); err == nil {
+		t.Fatal("expected error for bad table name")
+	}
+
+	db := testMysql(t)
+	table := "gathertool_add_column"
+	_ = db.Exec("DROP TABLE IF EXISTS " + table)
+	defer db.Exec("DROP TABLE IF EXISTS " + table)
+	if err := db.NewTable(table, map[string]string{"name": "string"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := db.ColumnExists(table, "price")
+	if err != nil || ok {
+		t.Fatalf("ColumnExists before add = %v, %v", ok, err)
+	}
+	if err := db.AddColumn(table, "price", "float"); err != nil {
+		t.Fatal(err)
+	}
+	// 已存在的字段不会重复添加
+	if err := db.AddColumn(table, "price", "float"); err != nil {
+		t.Fatal(err)
+	}
+	ok, err = db.ColumnExists(table, "price")
+	if err != nil || !ok {
+		t.Fatalf("ColumnExists after add = %v, %v", ok, err)
+	}
+}
+
+func TestSplitSqlScript(t *testing.T){
+	script := `
+-- 初始化
+CREATE TABLE a (id int, name varchar(10)); # 表a
+/* 多行
+   注释; */
+INSERT INTO a VALUES (1, 'x;y'), (2, "it\'s; ok");
+INSERT INTO a VALUES (3, 'a--b');;
+UPDATE ` + "`a`" + ` SET name = 'c' WHERE id = 3
+`
+	got := SplitSqlScript(script)
+	want := []string{
+		"CREATE TABLE a (id int, name varchar(10))",
+		`INSERT INTO a VALUES (1, 'x;y'), (2, "it\'s; ok")`,
+		"INSERT INTO a VALUES (3, 'a--b')",
+		"UPDATE `a` SET name = 'c' WHERE id = 3",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d statements: %q", len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("statement %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestExecMany(t *testing.T){
+	db := testMysql(t)
+	_ = db.Exec("DROP TABLE IF EXISTS gathertool_exec_many")
+	defer db.Exec("DROP TABLE IF EXISTS gathertool_exec_many")
+	err := db.ExecScript(`
+		CREATE TABLE gathertool_exec_many (id int, name varchar(10));
+		INSERT INTO gathertool_exec_many VALUES (1, 'a;b');
+		INSERT INTO gathertool_exec_many VALUES (2, 'c');`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.Select("SELECT * FROM gathertool_exec_many ORDER BY id")
+	if err != nil || len(rows) != 2 || rows[0]["name"] != "a;b" {
+		t.Fatalf("rows = %v, err = %v", rows, err)
+	}
+
+	// 事务中出错回滚
+	err = db.ExecMany([]string{
+		"INSERT INTO gathertool_exec_many VALUES (3, 'd')",
+		"INSERT INTO gathertool_exec_many_none VALUES (4, 'e')",
+	}, true)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	rows, _ = db.Select("SELECT * FROM gathertool_exec_many")
+	if len(rows) != 2 {
+		t.Fatalf("rows after rollback = %v", rows)
+	}
+}
+
+func TestGenerateStructs(t *testing.T){
+	code := GenerateStructs(map[string]map[string]string{
+		"ip_list": {"id": "int", "start_ip": "string", "ctime": "time"},
+		"task":    {"id": "int", "score": "float", "raw": "[]byte"},
+	}, "model")
+	want := "package model\n\nimport \"time\"\n\n" +
+		"// IpList 表 ip_list\ntype IpList struct {\n" +
+		"\tCtime   time.Time `json:\"ctime\" db:\"ctime\"`\n" +
+		"\tID      int64     `json:\"id\" db:\"id\"`\n" +
+		"\tStartIp string    `json:\"start_ip\" db:\"start_ip\"`\n}\n\n" +
+		"// Task 表 task\ntype Task struct {\n" +
+		"\tID    int64   `json:\"id\" db:\"id\"`\n" +
+		"\tRaw   []byte  `json:\"raw\" db:\"raw\"`\n" +
+		"\tScore float64 `json:\"score\" db:\"score\"`\n}\n"
+	if code != want {
+		t.Fatalf("code =\n%s", code)
+	}
+}
+
+func TestDescribeAll(t *testing.T){
+	db := testMysql(t)
+	for _, table := range []string{"gathertool_describe_a", "gathertool_describe_b"} {
+		_ = db.Exec("DROP TABLE IF EXISTS " + table)
+		defer db.Exec("DROP TABLE IF EXISTS " + table)
+	}
+	if err := db.NewTable("gathertool_describe_a", map[string]string{"name": "string"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.NewTable("gathertool_describe_b", map[string]string{"price": "float", "cost": "decimal(10,2)"}); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := db.DescribeAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema["gathertool_describe_a"]["name"] != "string" || schema["gathertool_describe_b"]["price"] != "float" ||
+		schema["gathertool_describe_b"]["cost"] != "float" {
+		t.Fatalf("schema = %v", schema)
+	}
+}
+
+func TestRetryConn(t *testing.T){
+	// 先占用一个端口再释放, 延迟后再监听, 模拟数据库启动较慢
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer l.Close()
+		time.Sleep(time.Second)
+	}()
+
+	tries := 0
+	dial := func() error {
+		tries++
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	if err := retryConn(10, 20*time.Millisecond, false, dial); err != nil {
+		t.Fatal(err)
+	}
+	if tries < 2 {
+		t.Fatalf("tries = %d", tries)
+	}
+
+	// 重试次数用完返回错误
+	tries = 0
+	if err := retryConn(2, time.Millisecond, false, func() error { tries++; return errors.New("refused") }); err == nil || tries != 3 {
+		t.Fatalf("tries = %d, err = %v", tries, err)
+	}
+}
+
+func TestConnRetry(t *testing.T){
+	db := testMysql(t)
+	db.CloseLog()
+	db.SetConnRetry(2, 10*time.Millisecond)
+	if err := db.Conn(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 数据库不可用时重试后返回错误
+	bad := *db
+	bad.Port = 1
+	start := time.Now()
+	if err := bad.Conn(); err == nil || time.Since(start) < 30*time.Millisecond {
+		t.Fatalf("err = %v after %v", err, time.Since(start))
+	}
+}
+
+func TestReplace(t *testing.T){
+	db := testMysql(t)
+	table := "gathertool_replace"
+	_ = db.Exec("DROP TABLE IF EXISTS " + table)
+	defer db.Exec("DROP TABLE IF EXISTS " + table)
+	if err := db.Exec("CREATE TABLE " + table + " (sku varchar(32) PRIMARY KEY, price double, name varchar(32))"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Replace(table, map[string]interface{}{"sku": "a1", "price": 9.9, "name": "O'Brien"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Replace(table, map[string]interface{}{"sku": "a1", "price": 19.9, "name": "O'Neil"}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.Select("SELECT * FROM " + table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["price"] != "19.9" || rows[0]["name"] != "O'Neil" {
+		t.Fatalf("rows = %v", rows)
+	}
+}
+
+func TestInsertQuote(t *testing.T){
+	db := testMysql(t)
+	table := "gathertool_insert_quote"
+	_ = db.Exec("DROP TABLE IF EXISTS " + table)
+	defer db.Exec("DROP TABLE IF EXISTS " + table)
+	if err := db.Exec("CREATE TABLE " + table + " (id int PRIMARY KEY, name varchar(64))"); err != nil {
+		t.Fatal(err)
+	}
+	name := `O'Brien"); DROP TABLE ` + table + `; --`
+	if err := db.Insert(table, map[string]interface{}{"id": 1, "name": name}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.Select("SELECT * FROM " + table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["id"] != "1" || rows[0]["name"] != name {
+		t.Fatalf("rows = %v", rows)
+	}
+}
+
+func TestTruncateForColumn(t *testing.T){
+	long := strings.Repeat("爬", 300)
+	cases := []struct {
+		value, colType string
+		want int // 截断后的字节数
+	}{
+		{"abcdef", "varchar(3)", 3},
+		{"爬虫工具", "VARCHAR(2)", 6},
+		{"abc", "varchar(10)", 3},
+		{long, "tinytext", 255},
+		{long + "a", "tinytext", 255},
+		{"a" + long, "tinytext", 253},
+		{long, "text", 900},
+		{long, "int(11)", 900},
+	}
+	for _, c := range cases {
+		got := TruncateForColumn(c.value, c.colType)
+		if len(got) != c.want || !strings.HasPrefix(c.value, got) {
+			t.Errorf("TruncateForColumn(%d bytes, %s) = %d bytes", len(c.value), c.colType, len(got))
+		}
+	}
+}
+
+func TestBufferedInserterOversize(t *testing.T){
+	var rows []map[string]interface{}
+	b := newBufferedInserter("test", 0, 0, func(table string, list []map[string]interface{}) error {
+		rows = append(rows, list...)
+		return nil
+	})
+	b.columnTypes = func(table string) (map[string]string, error) {
+		return map[string]string{"name": "varchar(5)", "age": "int(11)"}, nil
+	}
+
+	data := map[string]interface{}{"name": "gathertool", "age": 1}
+	b.SetOversize(OversizeError)
+	if err := b.Add(data); err == nil {
+		t.Fatal("expected oversize error")
+	}
+	b.SetOversize(OversizeTruncate)
+	if err := b.Add(data); err != nil {
+		t.Fatal(err)
+	}
+	_ = b.Close()
+	if len(rows) != 1 || rows[0]["name"] != "gathe" || data["name"] != "gathertool" {
+		t.Fatalf("rows = %v, data = %v", rows, data)
+	}
+}
+
+// fakeRows 模拟查询结果
+type fakeRows struct {
+	columns []string
+	rows    [][]interface{}
+	i       int
+}
+
+func (f *fakeRows) Columns() ([]string, error) { return f.columns, nil }
+func (f *fakeRows) Next() bool                 { f.i++; return f.i <= len(f.rows) }
+func (f *fakeRows) Err() error                 { return nil }
+func (f *fakeRows) Scan(dest ...interface{}) error {
+	for i, v := range f.rows[f.i-1] {
+		if v == nil {
+			*dest[i].(*sql.RawBytes) = nil
+		} else {
+			*dest[i].(*sql.RawBytes) = sql.RawBytes(v.(string))
+		}
+	}
+	return nil
+}
+
+func TestSelectJSON(t *testing.T){
+	var buf bytes.Buffer
+	rows := &fakeRows{
+		columns: []string{"id", "name"},
+		rows:    [][]interface{}{{"1", `O'Brien "ob"`}, {"2", nil}},
+	}
+	if err := writeRowsJSON(rows, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("%v : %s", err, buf.String())
+	}
+	if len(got) != 2 || got[0]["name"] != `O'Brien "ob"` || got[1]["id"] != "2" || got[1]["name"] != nil {
+		t.Fatalf("rows = %v", got)
+	}
+
+	buf.Reset()
+	if err := writeRowsJSON(&fakeRows{columns: []string{"id"}}, &buf); err != nil || buf.String() != "[]" {
+		t.Fatalf("empty = %q, %v", buf.String(), err)
+	}
+
+	db := testMysql(t)
+	buf.Reset()
+	if err := db.SelectJSON("SELECT 1 AS id, 'a' AS name", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil || len(got) != 1 || got[0]["name"] != "a" {
+		t.Fatalf("rows = %v, err = %v", got, err)
+	}
+}
@@ -0,0 +1,222 @@
+/*
+	Description : 请求的可选设置, 在每次发送请求前(包括重试)生效
+	Author : ManGe
+	Version : v0.1
+	Date : 2021-04-29
+*/
+
+package gathertool
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WithCookieString 设置从浏览器复制的 Cookie 字符串, 如 "a=1; b=2"
+// 重试时同名 cookie 会被覆盖而不是重复添加
+func WithCookieString(cookie string) ReqFunc {
+	cookies := (&http.Request{Header: http.Header{"Cookie": {cookie}}}).Cookies()
+	return func(req *http.Request) {
+		setCookies(req, cookies)
+	}
+}
+
+// setCookies 设置 cookie, 覆盖请求中已有的同名 cookie
+func setCookies(req *http.Request, cookies []*http.Cookie) {
+	names := make(map[string]bool, len(cookies))
+	for _, cookie := range cookies {
+		names[cookie.Name] = true
+	}
+	old := req.Cookies()
+	req.Header.Del("Cookie")
+	for _, cookie := range old {
+		if !names[cookie.Name] {
+			req.AddCookie(cookie)
+		}
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+}
+
+// WithHost 设置请求的 Host, 与连接的地址无关, 用于虚拟主机
+func WithHost(host string) ReqFunc {
+	return func(req *http.Request) {
+		req.Host = host
+	}
+}
+
+// WithLanguage 设置 Accept-Language, 按传入的顺序从高到低设置权重
+// 带地区的语言后会补上通用的语言(没有单独传入时), 如 WithLanguage("zh-CN", "en") 为 "zh-CN,zh;q=0.9,en;q=0.8"
+func WithLanguage(langs ...string) ReqFunc {
+	return func(req *http.Request) {
+		req.Header.Set("Accept-Language", acceptLanguage(langs))
+	}
+}
+
+// acceptLanguage 生成带权重的 Accept-Language, 权重每个递减0.1, 最小为0.1
+func acceptLanguage(langs []string) string {
+	given := make(map[string]bool, len(langs))
+	for _, lang := range langs {
+		given[strings.ToLower(strings.TrimSpace(lang))] = true
+	}
+	list := make([]string, 0, len(langs))
+	seen := make(map[string]bool, len(langs))
+	add := func(lang string) {
+		if lang == "" || seen[strings.ToLower(lang)] {
+			return
+		}
+		seen[strings.ToLower(lang)] = true
+		list = append(list, lang)
+	}
+	for _, lang := range langs {
+		lang = strings.TrimSpace(lang)
+		add(lang)
+		if i := strings.Index(lang, "-"); i > 0 && !given[strings.ToLower(lang[:i])] {
+			add(lang[:i])
+		}
+	}
+
+	var buf strings.Builder
+	for i, lang := range list {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString(lang)
+		if i == 0 {
+			continue
+		}
+		q := 10 - i
+		if q < 1 {
+			q = 1
+		}
+		buf.WriteString(fmt.Sprintf(";q=0.%d", q))
+	}
+	return buf.String()
+}
+
+// WithTrailer 设置请求的 trailer, 请求体使用 chunked 编码发送以带上 trailer
+// 只在 HTTP/1.1 的 chunked 编码或 HTTP/2 中有效, 没有请求体时发送空的 chunked 请求体
+func WithTrailer(trailer map[string]string) ReqFunc {
+	return func(req *http.Request) {
+		req.Trailer = make(http.Header, len(trailer))
+		for k, v := range trailer {
+			req.Trailer.Set(k, v)
+		}
+		if req.Body == nil || req.Body == http.NoBody {
+			req.Body = ioutil.NopCloser(strings.NewReader(""))
+			req.GetBody = func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(strings.NewReader("")), nil
+			}
+		}
+		req.ContentLength = -1
+		req.TransferEncoding = []string{"chunked"}
+	}
+}
+
+// NewClient 复制 base(nil 时为默认的 Client)并应用 ClientFunc, 返回的 Client 作为请求的可变参数复用
+// ClientFunc 直接作为请求的可变参数时每个请求都会复制一次 Transport, 不能复用连接与TLS会话,
+// 多次请求使用相同的设置(如 WithClientCert)时应先用 NewClient 创建 Client
+func NewClient(base *http.Client, fs ...ClientFunc) (*http.Client, error) {
+	if base == nil {
+		base = &http.Client{Timeout: 60*time.Second}
+	}
+	client := copyClient(base)
+	for _, f := range fs {
+		if err := f(client); err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// WithClientCert 加载客户端证书, 用于双向认证(mTLS)
+// 多次请求时用 NewClient 创建 Client 复用, 见 NewClient
+func WithClientCert(certPath, keyPath string) ClientFunc {
+	return func(client *http.Client) error {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return err
+		}
+		return WithTLSCert(cert)(client)
+	}
+}
+
+// WithTLSCert 设置客户端证书, 用于双向认证(mTLS), 多次请求时见 NewClient
+func WithTLSCert(cert tls.Certificate) ClientFunc {
+	return func(client *http.Client) error {
+		t, err := httpTransport(client)
+		if err != nil {
+			return err
+		}
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		t.TLSClientConfig.Certificates = append(t.TLSClientConfig.Certificates, cert)
+		return nil
+	}
+}
+
+// WithLocalAddr 设置发出请求的本地IP, 用于多网卡或多出口IP的机器
+// 每个 worker 使用不同的出口IP时, 在 ClientFactory 中对各自的 Client 调用 WithLocalAddr(ip)(client)
+func WithLocalAddr(ip string) ClientFunc {
+	return func(client *http.Client) error {
+		addr := net.ParseIP(ip)
+		if addr == nil {
+			return fmt.Errorf("local addr %q is not ip", ip)
+		}
+		t, err := httpTransport(client)
+		if err != nil {
+			return err
+		}
+		dialer := &net.Dialer{
+			LocalAddr: &net.TCPAddr{IP: addr},
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}
+		t.DialContext = dialer.DialContext
+		return nil
+	}
+}
+
+// DisableKeepAlive 每个请求都使用新的连接, 用于复用连接会被拦截的站点
+// 请求默认带有 Connection: close, 但可能被传入的 http.Header 覆盖, 这里在 Transport 上关闭连接复用
+func DisableKeepAlive() ClientFunc {
+	return func(client *http.Client) error {
+		t, err := httpTransport(client)
+		if err != nil {
+			return err
+		}
+		t.DisableKeepAlives = true
+		return nil
+	}
+}
+
+// WithRequestID 为请求生成随机的请求ID(UUID), 保存在 Context.RequestID, 该请求的日志都带上请求ID
+// header 为 true 时同时设置请求头 X-Request-ID, 重试时请求ID不变
+func WithRequestID(header bool) ContextFunc {
+	return func(c *Context) {
+		c.RequestID = newRequestID()
+		if header && c.Req != nil {
+			c.Req.Header.Set("X-Request-ID", c.RequestID)
+		}
+	}
+}
+
+// newRequestID 生成 UUID v4
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
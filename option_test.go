@@ -0,0 +1,336 @@
+package gathertool
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithCookieString(t *testing.T) {
+	var (
+		times   int
+		cookies []string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		times++
+		cookies = r.Header["Cookie"]
+		if times == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	c, err := Get(ts.URL, WithCookieString("sid=abc; token=x=y; lang=zh"), &http.Cookie{Name: "sid", Value: "old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+
+	if times != 2 {
+		t.Fatalf("times = %d", times)
+	}
+	if len(cookies) != 1 || cookies[0] != "sid=abc; token=x=y; lang=zh" {
+		t.Fatalf("Cookie = %q", cookies)
+	}
+}
+
+func TestWithHost(t *testing.T) {
+	var host string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+	}))
+	defer ts.Close()
+
+	c, err := Get(ts.URL, WithHost("www.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if host != "www.example.com" {
+		t.Fatalf("Host = %s", host)
+	}
+}
+
+// newClientCert 生成自签名的客户端证书, 返回 pem 格式的证书与私钥
+func newClientCert(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gathertool"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func TestWithClientCert(t *testing.T) {
+	certPem, keyPem := newClientCert(t)
+	dir, err := ioutil.TempDir("", "cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certPath, keyPath := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	_ = ioutil.WriteFile(certPath, certPem, 0600)
+	_ = ioutil.WriteFile(keyPath, keyPem, 0600)
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPem)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	ts.StartTLS()
+	defer ts.Close()
+
+	// ts.Client() 信任服务端证书, 客户端证书与其 TLS 设置组合
+	c, err := Get(ts.URL, ts.Client(), WithClientCert(certPath, keyPath), RetryTimes(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if string(c.RespBody) != "gathertool" {
+		t.Fatalf("body = %q, err = %v", c.RespBody, c.Err)
+	}
+	if len(ts.Client().Transport.(*http.Transport).TLSClientConfig.Certificates) != 0 {
+		t.Fatal("the passed client was modified")
+	}
+
+	c, err = Get(ts.URL, ts.Client(), RetryTimes(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if c.Err == nil {
+		t.Fatal("request without client cert succeeded")
+	}
+
+	if _, err := Get(ts.URL, WithClientCert(filepath.Join(dir, "none.crt"), keyPath)); err == nil {
+		t.Fatal("expected error loading missing cert")
+	}
+
+	// NewClient 只复制一次 Transport, 之后的请求复用
+	client, err := NewClient(ts.Client(), WithClientCert(certPath, keyPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		c, _ = Get(ts.URL, client, RetryTimes(1))
+		c.Do()
+		if string(c.RespBody) != "gathertool" || c.baseClient != client {
+			t.Fatalf("body = %q, err = %v", c.RespBody, c.Err)
+		}
+	}
+	if len(ts.Client().Transport.(*http.Transport).TLSClientConfig.Certificates) != 0 {
+		t.Fatal("the base client was modified")
+	}
+	if _, err := NewClient(nil, WithLocalAddr("eth0")); err == nil {
+		t.Fatal("expected error from client func")
+	}
+}
+
+func TestSetURLRewriter(t *testing.T) {
+	var queries []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		if len(queries) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	SetURLRewriter(func(u *url.URL) {
+		u.Path = "/cache" + u.Path
+		q := u.Query()
+		q.Add("from", "gathertool")
+		u.RawQuery = q.Encode()
+	})
+	defer SetURLRewriter(nil)
+
+	c, err := Get(ts.URL + "/a?id=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if len(queries) != 2 || queries[0] != "from=gathertool&id=1" || queries[1] != queries[0] {
+		t.Fatalf("queries = %q", queries)
+	}
+	if c.Req.URL.Path != "/cache/a" {
+		t.Fatalf("path = %s", c.Req.URL.Path)
+	}
+}
+
+func TestWithLanguage(t *testing.T) {
+	var langs []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		langs = append(langs, r.Header.Get("Accept-Language"))
+		if len(langs) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	c, err := Get(ts.URL, WithLanguage("zh-CN", "en"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	want := "zh-CN,zh;q=0.9,en;q=0.8"
+	if len(langs) != 2 || langs[0] != want || langs[1] != want {
+		t.Fatalf("Accept-Language = %v", langs)
+	}
+
+	cases := map[string][]string{
+		"zh-TW,zh;q=0.9,en-US;q=0.8,en;q=0.7": {"zh-TW", "zh", "en-US"},
+		"ja":                                  {"ja"},
+		"a,b;q=0.9,c;q=0.8,d;q=0.7,e;q=0.6,f;q=0.5,g;q=0.4,h;q=0.3,i;q=0.2,j;q=0.1,k;q=0.1": {"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"},
+	}
+	for want, in := range cases {
+		if got := acceptLanguage(in); got != want {
+			t.Fatalf("acceptLanguage(%v) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestWithTrailer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		// trailer 在读完请求体后才可以读取
+		fmt.Fprintf(w, "%s|%s|%s|%v", body, r.Trailer.Get("Grpc-Status"), r.Trailer.Get("X-Checksum"), r.TransferEncoding)
+	}))
+	defer ts.Close()
+
+	c, err := PostJson(ts.URL, `{"a":1}`, WithTrailer(map[string]string{"grpc-status": "0", "X-Checksum": "abc"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if string(c.RespBody) != `{"a":1}|0|abc|[chunked]` {
+		t.Fatalf("body = %q", c.RespBody)
+	}
+
+	c, err = Get(ts.URL, WithTrailer(map[string]string{"X-Checksum": "empty"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if string(c.RespBody) != `||empty|[chunked]` {
+		t.Fatalf("body = %q", c.RespBody)
+	}
+}
+
+func TestWithLocalAddr(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		fmt.Fprint(w, host)
+	}))
+	defer ts.Close()
+
+	c, err := Get(ts.URL, WithLocalAddr("127.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if string(c.RespBody) != "127.0.0.1" {
+		t.Fatalf("remote addr = %q", c.RespBody)
+	}
+
+	if _, err := Get(ts.URL, WithLocalAddr("eth0")); err == nil {
+		t.Fatal("expected error for bad ip")
+	}
+}
+
+func TestDisableKeepAlive(t *testing.T) {
+	var conns int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	ts.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	client := &http.Client{Transport: &http.Transport{}}
+	keepAlive := http.Header{"Connection": []string{"keep-alive"}}
+	get := func() {
+		c, err := Get(ts.URL, client, keepAlive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Do()
+	}
+
+	get()
+	get()
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Fatalf("keep-alive conns = %d", n)
+	}
+
+	// 同一个 Client 上关闭连接复用
+	atomic.StoreInt32(&conns, 0)
+	if err := DisableKeepAlive()(client); err != nil {
+		t.Fatal(err)
+	}
+	get()
+	get()
+	if n := atomic.LoadInt32(&conns); n != 2 {
+		t.Fatalf("conns = %d", n)
+	}
+}
+
+func TestWithRequestID(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("X-Request-ID"))
+	}))
+	defer ts.Close()
+
+	c, err := Get(ts.URL, WithRequestID(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if len(c.RequestID) != 36 || string(c.RespBody) != c.RequestID {
+		t.Fatalf("RequestID = %q, header = %q", c.RequestID, c.RespBody)
+	}
+
+	c2, _ := Get(ts.URL, WithRequestID(false))
+	c2.Do()
+	if c2.RequestID == "" || c2.RequestID == c.RequestID || len(c2.RespBody) != 0 {
+		t.Fatalf("RequestID = %q, header = %q", c2.RequestID, c2.RespBody)
+	}
+}
@@ -0,0 +1,72 @@
+package gathertool
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// FormPaginator 表单分页, POST 表单中的页码字段递增翻页
+type FormPaginator struct {
+	Url string
+
+	// 每页都会提交的表单
+	Form url.Values
+
+	// 页码字段名
+	PageField string
+
+	// 起始页码, 默认为1
+	StartPage int
+
+	// 最大页码, 0为不限制
+	MaxPage int
+}
+
+// NewFormPaginator 新建表单分页
+func NewFormPaginator(url string, form url.Values, pageField string) *FormPaginator {
+	return &FormPaginator{
+		Url:       url,
+		Form:      form,
+		PageField: pageField,
+		StartPage: 1,
+	}
+}
+
+// Run 从起始页开始逐页请求, onPage 返回 true 时结束
+// 分页查询没有副作用, 请求失败时会按 RetryTimes 重试(默认开启 RetryNonIdempotent); vs 与 Post 相同
+// 某一页重试后仍失败则结束并返回错误
+func (p *FormPaginator) Run(onPage func(c *Context, page int) bool, vs ...interface{}) error {
+	if p.PageField == "" {
+		return errors.New("page field is null.")
+	}
+	page := p.StartPage
+	if page < 1 {
+		page = 1
+	}
+	vs = append([]interface{}{RetryNonIdempotent()}, vs...)
+	for ; p.MaxPage < 1 || page <= p.MaxPage; page++ {
+		form := url.Values{}
+		for k, v := range p.Form {
+			form[k] = append([]string{}, v...)
+		}
+		form.Set(p.PageField, strconv.Itoa(page))
+
+		c, err := Post(p.Url, []byte(form.Encode()), "application/x-www-form-urlencoded", vs...)
+		if err != nil {
+			return err
+		}
+		c.Do()
+		if c.RespBody == nil {
+			if c.Err != nil {
+				return c.Err
+			}
+			return fmt.Errorf("page %d request failed", page)
+		}
+		if onPage(c, page) {
+			return nil
+		}
+	}
+	return nil
+}
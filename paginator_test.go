@@ -0,0 +1,44 @@
+package gathertool
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestFormPaginator(t *testing.T) {
+	retried := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.FormValue("type") != "ip" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		page := r.FormValue("page")
+		if page == "2" && !retried {
+			retried = true
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if page == "3" {
+			fmt.Fprint(w, "page 3 last")
+			return
+		}
+		fmt.Fprint(w, "page "+page)
+	}))
+	defer ts.Close()
+
+	pages := make([]string, 0)
+	p := NewFormPaginator(ts.URL, url.Values{"type": {"ip"}}, "page")
+	err := p.Run(func(c *Context, page int) bool {
+		pages = append(pages, string(c.RespBody))
+		return string(c.RespBody) == "page 3 last"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(pages) != "[page 1 page 2 page 3 last]" || !retried {
+		t.Fatalf("pages = %q, retried = %v", pages, retried)
+	}
+}
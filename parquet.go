@@ -0,0 +1,201 @@
+package gathertool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// ParquetWriter 将抓取的数据写入 Parquet 文件, 并发安全
+// 结构体使用 parquet-go 的 tag 定义表结构, 如 `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
+// 也可以根据第一条 map 数据推断表结构, 见 NewParquetWriterFromRecord
+type ParquetWriter struct {
+	// 每写入多少行输出一个 row group, 默认 10000
+	FlushEvery int64
+
+	mux    sync.Mutex
+	file   *parquetFile
+	pw     *writer.ParquetWriter
+	jw     *writer.JSONWriter
+	fields map[string]string
+	rows   int64
+}
+
+// NewParquetWriter 新建 Parquet 文件, obj 为带 parquet tag 的结构体指针, 写入的每行为该结构体
+func NewParquetWriter(path string, obj interface{}) (*ParquetWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	pf := &parquetFile{f}
+	pw, err := writer.NewParquetWriter(pf, obj, 1)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &ParquetWriter{FlushEvery: 10000, file: pf, pw: pw}, nil
+}
+
+// NewParquetWriterFromRecord 新建 Parquet 文件, 根据 record 推断表结构, 写入的每行为 map[string]interface{}
+// string 为 UTF8, 整数为 INT64, 浮点数为 DOUBLE, bool 为 BOOLEAN, time.Time 为 RFC3339 字符串, 其他类型转为字符串
+// 所有字段都可以为空, 之后的数据中表结构以外的字段会被忽略
+func NewParquetWriterFromRecord(path string, record map[string]interface{}) (*ParquetWriter, error) {
+	if len(record) == 0 {
+		return nil, errors.New("record is null.")
+	}
+	keys := make([]string, 0, len(record))
+	for k := range record {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fields := make(map[string]string, len(keys))
+	tags := make([]string, 0, len(keys))
+	for _, k := range keys {
+		t := parquetType(record[k])
+		fields[k] = t
+		tags = append(tags, fmt.Sprintf(`{"Tag": "name=%s, %s, repetitiontype=OPTIONAL"}`, k, t))
+	}
+	schema := `{"Tag": "name=parquet_go_root, repetitiontype=REQUIRED", "Fields": [` + strings.Join(tags, ",") + `]}`
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	pf := &parquetFile{f}
+	jw, err := writer.NewJSONWriter(schema, pf, 1)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &ParquetWriter{FlushEvery: 10000, file: pf, jw: jw, fields: fields}, nil
+}
+
+// parquetType 根据值推断 Parquet 的字段类型
+func parquetType(v interface{}) string {
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return "type=INT64"
+	case reflect.Float32, reflect.Float64:
+		return "type=DOUBLE"
+	case reflect.Bool:
+		return "type=BOOLEAN"
+	}
+	return "type=BYTE_ARRAY, convertedtype=UTF8"
+}
+
+// Write 写入一行, 结构体模式传入结构体或其指针, 推断模式传入 map[string]interface{}
+func (p *ParquetWriter) Write(row interface{}) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.pw != nil {
+		if err := p.pw.Write(row); err != nil {
+			return err
+		}
+	} else {
+		record, ok := row.(map[string]interface{})
+		if !ok {
+			return errors.New("row is not map[string]interface{}.")
+		}
+		b, err := json.Marshal(p.jsonRecord(record))
+		if err != nil {
+			return err
+		}
+		if err := p.jw.Write(string(b)); err != nil {
+			return err
+		}
+	}
+	p.rows++
+	if p.FlushEvery > 0 && p.rows%p.FlushEvery == 0 {
+		return p.writer().Flush(true)
+	}
+	return nil
+}
+
+// jsonRecord 按推断的表结构转换值, 去除表结构以外的字段
+func (p *ParquetWriter) jsonRecord(record map[string]interface{}) map[string]interface{} {
+	data := make(map[string]interface{}, len(p.fields))
+	for k, t := range p.fields {
+		v, ok := record[k]
+		if !ok || v == nil {
+			continue
+		}
+		if t == "type=BYTE_ARRAY, convertedtype=UTF8" {
+			switch vv := v.(type) {
+			case string:
+			case time.Time:
+				v = vv.Format(time.RFC3339)
+			case []byte:
+				v = string(vv)
+			default:
+				v = fmt.Sprint(vv)
+			}
+		}
+		data[k] = v
+	}
+	return data
+}
+
+func (p *ParquetWriter) writer() *writer.ParquetWriter {
+	if p.pw != nil {
+		return p.pw
+	}
+	return &p.jw.ParquetWriter
+}
+
+// Rows 已写入的行数
+func (p *ParquetWriter) Rows() int64 {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.rows
+}
+
+// Close 写入剩余的数据与文件尾并关闭文件
+func (p *ParquetWriter) Close() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if err := p.writer().WriteStop(); err != nil {
+		p.file.Close()
+		return err
+	}
+	return p.file.Close()
+}
+
+// parquetFile 本地文件, 实现 parquet-go 的 source.ParquetFile
+type parquetFile struct {
+	*os.File
+}
+
+// OpenParquetFile 打开本地的 Parquet 文件, 用于 parquet-go 的 reader 读取
+func OpenParquetFile(path string) (source.ParquetFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &parquetFile{f}, nil
+}
+
+func (f *parquetFile) Open(name string) (source.ParquetFile, error) {
+	if name == "" {
+		name = f.Name()
+	}
+	return OpenParquetFile(name)
+}
+
+func (f *parquetFile) Create(name string) (source.ParquetFile, error) {
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &parquetFile{file}, nil
+}
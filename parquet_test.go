@@ -0,0 +1,122 @@
+package gathertool
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+type parquetIP struct {
+	Start  string  `parquet:"name=start, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Number int64   `parquet:"name=number, type=INT64"`
+	Score  float64 `parquet:"name=score, type=DOUBLE"`
+}
+
+func readParquet(t *testing.T, path string, obj interface{}, rows interface{}, n int) {
+	pf, err := OpenParquetFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pf.Close()
+	pr, err := reader.NewParquetReader(pf, obj, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.ReadStop()
+	if int(pr.GetNumRows()) != n {
+		t.Fatalf("rows = %d, want %d", pr.GetNumRows(), n)
+	}
+	if err := pr.Read(rows); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParquetWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ip.parquet")
+
+	w, err := NewParquetWriter(path, new(parquetIP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.FlushEvery = 7
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				n := i*5 + j
+				if err := w.Write(parquetIP{Start: fmt.Sprintf("1.0.%d.0", n), Number: int64(n), Score: float64(n) / 2}); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := make([]parquetIP, 20)
+	readParquet(t, path, new(parquetIP), &rows, 20)
+	seen := make(map[int64]bool)
+	for _, row := range rows {
+		if row.Start != fmt.Sprintf("1.0.%d.0", row.Number) || row.Score != float64(row.Number)/2 {
+			t.Fatalf("row = %+v", row)
+		}
+		seen[row.Number] = true
+	}
+	if len(seen) != 20 {
+		t.Fatalf("rows = %+v", rows)
+	}
+}
+
+func TestParquetWriterFromRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "record.parquet")
+
+	records := []map[string]interface{}{
+		{"start": "1.0.1.0", "number": 256, "score": 1.5},
+		{"start": "1.0.2.0", "number": 512, "other": "x"},
+	}
+	w, err := NewParquetWriterFromRecord(path, records[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		if err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	type row struct {
+		Number *int64   `parquet:"name=number, type=INT64, repetitiontype=OPTIONAL"`
+		Score  *float64 `parquet:"name=score, type=DOUBLE, repetitiontype=OPTIONAL"`
+		Start  *string  `parquet:"name=start, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	}
+	rows := make([]row, 2)
+	readParquet(t, path, new(row), &rows, 2)
+	if *rows[0].Start != "1.0.1.0" || *rows[0].Number != 256 || *rows[0].Score != 1.5 {
+		t.Fatalf("row 0 = %v %v %v", *rows[0].Start, *rows[0].Number, *rows[0].Score)
+	}
+	if *rows[1].Start != "1.0.2.0" || *rows[1].Number != 512 || rows[1].Score != nil {
+		t.Fatalf("row 1 = %+v", rows[1])
+	}
+}
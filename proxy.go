@@ -0,0 +1,376 @@
+/*
+	Description : 代理池
+	Author : ManGe
+	Version : v0.1
+	Date : 2021-04-29
+*/
+
+package gathertool
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// 代理对象
+type proxy struct {
+	Url *url.URL
+
+	// 连续失败的次数
+	fail int
+}
+
+// ProxyPool   代理池
+type proxyPool struct {
+	proxy   []*proxy
+	mux     sync.Mutex
+	watcher *fsnotify.Watcher
+
+	// 连续失败多少次后移除代理, 0 不移除, 见 SetMaxFail
+	maxFail int
+
+	// 每个 Transport 与代理对应的 Transport, 同一个代理的请求复用连接
+	// transportKeys 按最近使用排序, 超过 maxProxyTransports 个时关闭最久未使用的
+	transports    map[proxyTransportKey]*http.Transport
+	transportKeys []proxyTransportKey
+}
+
+// 代理池最多缓存的 Transport 数量
+// ClientFunc 作为请求参数时每个请求的 Transport 都不同, 缓存需要有上限
+const maxProxyTransports = 256
+
+type proxyTransportKey struct {
+	base  *http.Transport
+	proxy string
+}
+
+var ProxyPool = &proxyPool{}
+
+// NewProxyPool 新建一个代理池
+func NewProxyPool() *proxyPool {
+	return &proxyPool{}
+}
+
+// parseProxy 解析代理地址, 支持 host:port 与完整的url
+func parseProxy(proxyUrl string) (*url.URL, error) {
+	proxyUrl = strings.TrimSpace(proxyUrl)
+	if proxyUrl == "" {
+		return nil, errors.New("proxy url is null.")
+	}
+	if !strings.Contains(proxyUrl, "://") {
+		proxyUrl = "http://" + proxyUrl
+	}
+	u, err := url.Parse(proxyUrl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, errors.New("proxy url is bad : " + proxyUrl)
+	}
+	return u, nil
+}
+
+// Add 添加代理
+func (p *proxyPool) Add(proxyUrl string) error {
+	u, err := parseProxy(proxyUrl)
+	if err != nil {
+		return err
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for _, v := range p.proxy {
+		if v.Url.String() == u.String() {
+			return nil
+		}
+	}
+	p.proxy = append(p.proxy, &proxy{Url: u})
+	return nil
+}
+
+// Get 随机获取一个代理
+func (p *proxyPool) Get() (*url.URL, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if len(p.proxy) == 0 {
+		return nil, errors.New("proxy pool is empty.")
+	}
+	return p.proxy[rand.Intn(len(p.proxy))].Url, nil
+}
+
+// Remove 移除代理
+func (p *proxyPool) Remove(proxyUrl string) {
+	u, err := parseProxy(proxyUrl)
+	if err != nil {
+		return
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for i, v := range p.proxy {
+		if v.Url.String() == u.String() {
+			p.proxy = append(p.proxy[:i], p.proxy[i+1:]...)
+			p.closeTransports(u)
+			return
+		}
+	}
+}
+
+// SetMaxFail 代理连续失败 n 次后从代理池移除, n <= 0 不移除
+// 只对 WithProxyPool 的请求生效: 请求出错或状态码为重试(StatusCodeMap 的 retry)记一次失败, 成功后清零
+func (p *proxyPool) SetMaxFail(n int) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.maxFail = n
+}
+
+// Fail 记录代理失败一次, 连续失败达到 SetMaxFail 的次数后移除
+func (p *proxyPool) Fail(u *url.URL) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for i, v := range p.proxy {
+		if v.Url.String() != u.String() {
+			continue
+		}
+		v.fail++
+		if p.maxFail > 0 && v.fail >= p.maxFail {
+			log.Println("[Proxy] 连续失败 ", v.fail, " 次, 移除 : ", u.Host)
+			p.proxy = append(p.proxy[:i], p.proxy[i+1:]...)
+			p.closeTransports(u)
+		}
+		return
+	}
+}
+
+// Succeed 代理请求成功, 清零连续失败的次数
+func (p *proxyPool) Succeed(u *url.URL) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for _, v := range p.proxy {
+		if v.Url.String() == u.String() {
+			v.fail = 0
+			return
+		}
+	}
+}
+
+// Len 代理数量
+func (p *proxyPool) Len() int {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return len(p.proxy)
+}
+
+// LoadFile 从文件加载代理, 每行一个, # 开头为注释
+// 加载后代理池与文件内容一致, 仍在文件中的代理保留原有的失败次数, 已删除的代理关闭空闲连接
+func (p *proxyPool) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	list := make([]*url.URL, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := parseProxy(line)
+		if err != nil {
+			loger(err.Error())
+			continue
+		}
+		list = append(list, u)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	old := make(map[string]*proxy, len(p.proxy))
+	for _, v := range p.proxy {
+		old[v.Url.String()] = v
+	}
+	newProxy := make([]*proxy, 0, len(list))
+	for _, u := range list {
+		if v, ok := old[u.String()]; ok {
+			newProxy = append(newProxy, v)
+			delete(old, u.String())
+			continue
+		}
+		newProxy = append(newProxy, &proxy{Url: u})
+	}
+	p.proxy = newProxy
+	// 文件中已删除的代理释放连接
+	for _, v := range old {
+		p.closeTransports(v.Url)
+	}
+	return nil
+}
+
+// Watch 加载代理文件并监听, 文件变化后自动重新加载
+func (p *proxyPool) Watch(path string) error {
+	if err := p.LoadFile(path); err != nil {
+		return err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// 监听所在目录, 编辑器保存时可能是替换文件
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+	p.StopWatch()
+	p.mux.Lock()
+	p.watcher = watcher
+	p.mux.Unlock()
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != filepath.Clean(path) {
+					continue
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				if err := p.LoadFile(path); err != nil {
+					log.Println("[Proxy] Reload Fail : " + err.Error())
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Println("[Proxy] Watch Error : " + err.Error())
+			}
+		}
+	}()
+	return nil
+}
+
+// StopWatch 停止监听代理文件
+func (p *proxyPool) StopWatch() {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.watcher != nil {
+		_ = p.watcher.Close()
+		p.watcher = nil
+	}
+}
+
+// ProxyOnRetry 第一次请求直连, 每次重试从代理池随机取一个代理
+func ProxyOnRetry(pool *proxyPool) ContextFunc {
+	return func(c *Context) {
+		c.proxyOnRetry = pool
+	}
+}
+
+// WithProxyPool 每次请求(包括每次重试)从代理池随机取一个代理
+// 使用代理时连接错误也会重试(换一个代理), 代理的失败次数见 SetMaxFail
+func WithProxyPool(pool *proxyPool) ContextFunc {
+	return func(c *Context) {
+		c.proxyPool = pool
+	}
+}
+
+// transport 获取 base 使用代理 u 的 Transport, 第一次使用时复制 base, 之后复用
+// 缓存超过 maxProxyTransports 个时关闭并移除最久未使用的
+func (p *proxyPool) transport(base *http.Transport, u *url.URL) *http.Transport {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	key := proxyTransportKey{base: base, proxy: u.String()}
+	if t, ok := p.transports[key]; ok {
+		p.removeTransportKey(key)
+		p.transportKeys = append(p.transportKeys, key)
+		return t
+	}
+	t := base.Clone()
+	t.Proxy = http.ProxyURL(u)
+	if p.transports == nil {
+		p.transports = make(map[proxyTransportKey]*http.Transport)
+	}
+	p.transports[key] = t
+	p.transportKeys = append(p.transportKeys, key)
+	for len(p.transportKeys) > maxProxyTransports {
+		oldest := p.transportKeys[0]
+		p.transports[oldest].CloseIdleConnections()
+		delete(p.transports, oldest)
+		p.transportKeys = p.transportKeys[1:]
+	}
+	return t
+}
+
+// closeTransports 代理移除后关闭它的空闲连接, 调用方需持有锁
+func (p *proxyPool) closeTransports(u *url.URL) {
+	for k, t := range p.transports {
+		if k.proxy == u.String() {
+			t.CloseIdleConnections()
+			delete(p.transports, k)
+			p.removeTransportKey(k)
+		}
+	}
+}
+
+// removeTransportKey 从使用顺序中移除 key, 调用方需持有锁
+func (p *proxyPool) removeTransportKey(key proxyTransportKey) {
+	for i, k := range p.transportKeys {
+		if k == key {
+			p.transportKeys = append(p.transportKeys[:i], p.transportKeys[i+1:]...)
+			return
+		}
+	}
+}
+
+// useProxy 从代理池取一个代理设置到 Client, 复制 Client 不影响使用方传入的 Client
+// 每个代理的 Transport 由代理池缓存, 重试与后续请求复用连接; 返回使用的代理, 没有设置成功返回 nil
+func (c *Context) useProxy(pool *proxyPool) *url.URL {
+	u, err := pool.Get()
+	if err != nil {
+		log.Println("[Proxy] Get Fail : " + err.Error())
+		return nil
+	}
+	if c.proxyBase == nil {
+		switch t := c.Client.Transport.(type) {
+		case nil:
+			c.proxyBase = http.DefaultTransport.(*http.Transport)
+		case *http.Transport:
+			c.proxyBase = t
+		default:
+			log.Println("[Proxy] Set Fail : client transport is not *http.Transport")
+			return nil
+		}
+	}
+	client := *c.Client
+	client.Transport = pool.transport(c.proxyBase, u)
+	c.Client = &client
+	return u
+}
+
+// reportProxy 记录 WithProxyPool 使用的代理是否成功
+func (c *Context) reportProxy() {
+	if c.proxyPool == nil || c.proxyUsed == nil {
+		return
+	}
+	if c.Err != nil || (c.Resp != nil && StatusCodeMap[c.Resp.StatusCode] == "retry") {
+		c.proxyPool.Fail(c.proxyUsed)
+		return
+	}
+	c.proxyPool.Succeed(c.proxyUsed)
+}
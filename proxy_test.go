@@ -0,0 +1,224 @@
+package gathertool
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProxyPoolLoadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "proxies.txt")
+
+	err = ioutil.WriteFile(path, []byte("# 代理列表\n127.0.0.1:8080\n\nhttp://127.0.0.1:8081\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := NewProxyPool()
+	if err := pool.Watch(path); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.StopWatch()
+	if pool.Len() != 2 {
+		t.Fatalf("Len = %d", pool.Len())
+	}
+	pool.proxy[0].fail = 2
+
+	err = ioutil.WriteFile(path, []byte("127.0.0.1:8080\nsocks5://127.0.0.1:1080\nhttp://127.0.0.1:8082\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for pool.Len() != 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pool.Len() != 3 {
+		t.Fatalf("Len after reload = %d", pool.Len())
+	}
+
+	pool.mux.Lock()
+	defer pool.mux.Unlock()
+	want := []string{"http://127.0.0.1:8080", "socks5://127.0.0.1:1080", "http://127.0.0.1:8082"}
+	for i, v := range pool.proxy {
+		if v.Url.String() != want[i] {
+			t.Fatalf("proxy[%d] = %s, want %s", i, v.Url, want[i])
+		}
+	}
+	if pool.proxy[0].fail != 2 {
+		t.Fatal("health state was not preserved")
+	}
+}
+
+func TestProxyPoolLoadFileCloseTransports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "proxies.txt")
+
+	if err := ioutil.WriteFile(path, []byte("127.0.0.1:8080\n127.0.0.1:8081\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pool := NewProxyPool()
+	if err := pool.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	base := &http.Transport{}
+	keep := pool.transport(base, pool.proxy[0].Url)
+	pool.transport(base, pool.proxy[1].Url)
+
+	// 重新加载更短的列表, 删除的代理的 Transport 被释放
+	if err := ioutil.WriteFile(path, []byte("127.0.0.1:8080\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if pool.Len() != 1 || len(pool.transports) != 1 {
+		t.Fatalf("len = %d, %d transports", pool.Len(), len(pool.transports))
+	}
+	if pool.transport(base, pool.proxy[0].Url) != keep {
+		t.Fatal("transport of the kept proxy was not reused")
+	}
+}
+
+func TestProxyPoolTransportLimit(t *testing.T) {
+	pool := NewProxyPool()
+	u, _ := parseProxy("127.0.0.1:8080")
+	// 每个请求的 base Transport 不同时缓存不会无限增长
+	first := &http.Transport{}
+	pool.transport(first, u)
+	for i := 0; i < maxProxyTransports; i++ {
+		pool.transport(&http.Transport{}, u)
+	}
+	if len(pool.transports) != maxProxyTransports || len(pool.transportKeys) != maxProxyTransports {
+		t.Fatalf("%d transports, %d keys", len(pool.transports), len(pool.transportKeys))
+	}
+	if _, ok := pool.transports[proxyTransportKey{base: first, proxy: u.String()}]; ok {
+		t.Fatal("oldest transport was not evicted")
+	}
+
+	// 最近使用的不会被移除
+	recent := pool.transportKeys[0]
+	pool.transport(recent.base, u)
+	pool.transport(&http.Transport{}, u)
+	if _, ok := pool.transports[recent]; !ok {
+		t.Fatal("recently used transport was evicted")
+	}
+}
+
+func TestProxyPoolEmpty(t *testing.T) {
+	if _, err := NewProxyPool().Get(); err == nil {
+		t.Fatal("expected error from empty pool")
+	}
+}
+
+func TestProxyOnRetry(t *testing.T) {
+	var direct, proxied int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		direct++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied++
+		if r.URL.String() != ts.URL+"/page" {
+			t.Errorf("proxy got %s", r.URL)
+		}
+		fmt.Fprint(w, "via proxy")
+	}))
+	defer proxyServer.Close()
+
+	pool := NewProxyPool()
+	_ = pool.Add(proxyServer.URL)
+
+	c, err := Get(ts.URL+"/page", ProxyOnRetry(pool))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if direct != 1 || proxied != 1 || string(c.RespBody) != "via proxy" {
+		t.Fatalf("direct = %d, proxied = %d, body = %q", direct, proxied, c.RespBody)
+	}
+}
+
+func TestWithProxyPool(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "direct")
+	}))
+	defer ts.Close()
+	var proxied int32
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&proxied, 1)
+		fmt.Fprint(w, "via proxy")
+	}))
+	defer proxyServer.Close()
+	// 已关闭的端口作为不可用的代理
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := "http://" + l.Addr().String()
+	l.Close()
+
+	pool := NewProxyPool()
+	pool.SetMaxFail(2)
+	_ = pool.Add(dead)
+	failed := false
+	c, _ := Get(ts.URL, WithProxyPool(pool), FailedFunc(func(c *Context) { failed = true }))
+	c.Do()
+	if !failed || pool.Len() != 0 {
+		t.Fatalf("failed = %v, pool len = %d", failed, pool.Len())
+	}
+
+	// 没有设置 RetryFunc 也换代理重试, 重试次数用完执行 FailedFunc
+	pool.SetMaxFail(100)
+	_ = pool.Add(dead)
+	failed = false
+	c, _ = Get(ts.URL, WithProxyPool(pool), RetryTimes(2), FailedFunc(func(c *Context) { failed = true }))
+	c.Do()
+	if !failed || c.times != 2 || c.Err == nil {
+		t.Fatalf("failed = %v, times = %d, err = %v", failed, c.times, c.Err)
+	}
+	pool.Remove(dead)
+
+	// 不可用的代理失败后被移除, 重试换到可用的代理
+	pool.SetMaxFail(1)
+	_ = pool.Add(dead)
+	_ = pool.Add(proxyServer.URL)
+	for i := 0; i < 3; i++ {
+		c, _ = Get(ts.URL, WithProxyPool(pool))
+		c.Do()
+		if string(c.RespBody) != "via proxy" {
+			t.Fatalf("body = %q, err = %v", c.RespBody, c.Err)
+		}
+	}
+	if atomic.LoadInt32(&proxied) != 3 || pool.Len() > 2 {
+		t.Fatalf("proxied = %d, pool len = %d", proxied, pool.Len())
+	}
+
+	// 同一个代理的请求复用 Transport, 移除代理后释放
+	c2, _ := Get(ts.URL, WithProxyPool(pool))
+	c2.Do()
+	if c2.Client.Transport != c.Client.Transport || len(pool.transports) != 1 {
+		t.Fatalf("transport not reused, %d transports", len(pool.transports))
+	}
+	pool.Remove(proxyServer.URL)
+	if len(pool.transports) != 0 {
+		t.Fatalf("%d transports after remove", len(pool.transports))
+	}
+}
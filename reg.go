@@ -70,3 +70,48 @@ func RegHtmlTd(str string) []string { return regFind(runFuncName(), str) }
 func RegHtmlP(str string) []string { return regFind(runFuncName(), str) }
 
 func RegHtmlSpan(str string) []string { return regFind(runFuncName(), str) }
+
+// RegexExtract 正则提取, 每个匹配返回命名分组的值 如 `(?P<name>\w+)`
+// pattern 不是有效的正则时返回错误
+func RegexExtract(body, pattern string) ([]map[string]string, error) {
+	reg, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	names := reg.SubexpNames()
+	list := make([]map[string]string, 0)
+	for _, match := range reg.FindAllStringSubmatch(body, -1) {
+		item := make(map[string]string)
+		for i, name := range names {
+			if i == 0 || name == "" {
+				continue
+			}
+			item[name] = match[i]
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+// RegexEnqueue 正则提取并创建任务加入队列, urlGroup 分组的值为任务的 Url, 所有命名分组保存到 Task.Data
+// urlGroup 分组没有匹配到或为空的跳过; 返回加入队列的任务数
+func RegexEnqueue(queue TodoQueue, body, pattern, urlGroup string) (int, error) {
+	list, err := RegexExtract(body, pattern)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, item := range list {
+		if strings.TrimSpace(item[urlGroup]) == "" {
+			continue
+		}
+		data := make(map[string]interface{}, len(item))
+		for k, v := range item {
+			data[k] = v
+		}
+		if err := queue.Add(&Task{Url: item[urlGroup], Data: data}); err == nil {
+			n++
+		}
+	}
+	return n, nil
+}
@@ -279,3 +279,35 @@ fdgdg</a>
 
 `
 
+
+func TestRegexExtract(t *testing.T){
+	body := `id=1 name=mange url=http://a/1;id=2 name=gather url=http://a/2;id=3 name=empty url=;`
+	pattern := `id=(?P<id>\d+) name=(?P<name>\w+) url=(?P<url>[^;]*)`
+
+	list, err := RegexExtract(body, pattern)
+	if err != nil || len(list) != 3 {
+		t.Fatalf("list = %v, err = %v", list, err)
+	}
+	if list[0]["id"] != "1" || list[0]["name"] != "mange" || list[1]["url"] != "http://a/2" {
+		t.Fatalf("list = %v", list)
+	}
+	if _, err := RegexExtract(body, `(?P<url>`); err == nil {
+		t.Fatal("expected error for bad pattern")
+	}
+
+	// url 为空或没有 url 分组的匹配跳过
+	queue := NewQueue()
+	if n, err := RegexEnqueue(queue, body, pattern, "url"); err != nil || n != 2 {
+		t.Fatalf("enqueue %d, err = %v", n, err)
+	}
+	task := queue.Poll()
+	if task.Url != "http://a/1" || task.Data["name"] != "mange" {
+		t.Fatalf("task = %+v", task)
+	}
+	if n, err := RegexEnqueue(queue, body, pattern, "link"); err != nil || n != 0 {
+		t.Fatalf("enqueue %d, err = %v", n, err)
+	}
+	if _, err := RegexEnqueue(queue, body, `(?P<url>`, "url"); err == nil {
+		t.Fatal("expected error for bad pattern")
+	}
+}
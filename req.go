@@ -9,19 +9,123 @@ package gathertool
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 )
 
 var (
 	UrlBad error = errors.New("url is bad.") // 错误的url
+	OffHostRedirect error = errors.New("redirect to other host.") // 重定向到了其他host
+	ErrRedirectLoop error = errors.New("redirect loop.") // 重定向的地址重复出现
+	CrawlAborted error = errors.New("crawl aborted.") // 并发抓取被中止
+	ReqNull error = errors.New("request is null.") // Context 没有设置请求
+	BodyReadTimeOut error = errors.New("read body timeout.") // 读取响应body超时
+	HostRetryExhausted error = errors.New("host retry budget exhausted.") // host的重试次数已用完, 见 SetHostRetryBudget
 )
 
+// Context 没有设置 Client 时使用的默认 Client
+var defaultClient = &http.Client{
+	Timeout: 60*time.Second,
+}
+
 type ReqTimeOut int
 type ReqTimeOutMs int
 
+// 读取响应body的超时时间, 从开始读取body计时, 超时后按重试处理
+type ReadTimeOut int
+type ReadTimeOutMs int
+
+// 全局的url改写方法
+var (
+	urlRewriter func(u *url.URL)
+	urlRewriterMux sync.RWMutex
+)
+
+// SetURLRewriter 设置全局的url改写方法, 所有请求发送前执行, 如统一添加参数或改为内部缓存代理的路径
+// 在请求的 ReqFunc(如 WithHost)之后执行, 每个请求只执行一次(重试不会重复改写); 传 nil 取消
+func SetURLRewriter(rewriter func(u *url.URL)) {
+	urlRewriterMux.Lock()
+	defer urlRewriterMux.Unlock()
+	urlRewriter = rewriter
+}
+
+func getURLRewriter() func(u *url.URL) {
+	urlRewriterMux.RLock()
+	defer urlRewriterMux.RUnlock()
+	return urlRewriter
+}
+
+// 是否允许非幂等的请求(POST/PATCH)自动重试
+type NonIdempotentRetry bool
+
+// RetryNonIdempotent 允许非幂等的请求(POST/PATCH)自动重试
+// 默认只有 GET/HEAD/PUT/DELETE/OPTIONS 会重试, 非幂等的请求重试可能导致服务端重复处理(如重复下单)
+// 只有确认服务端可以安全处理重复请求时才开启
+func RetryNonIdempotent() NonIdempotentRetry {
+	return true
+}
+
+// 是否只允许同host的重定向
+type SameHostRedirect bool
+
+// SameHostRedirectsOnly 只跟随同host的重定向
+// 重定向到其他host时中止请求, c.Err 为 OffHostRedirect, 重定向的地址保存在 c.OffHostLocation
+func SameHostRedirectsOnly() SameHostRedirect {
+	return true
+}
+
+// 响应内容中需要重试的标记, 见 RetryOnBodyContains
+type BodyRetryMarkers []string
+
+// RetryOnBodyContains 成功的响应内容包含任一标记时按重试处理, 如返回 200 但内容为 {"error":"rate limited"}
+// 与状态码的重试相同, 受 MaxTimes 限制, 重试前执行 RetryFunc(可在其中等待), 用完重试次数执行 FailedFunc
+func RetryOnBodyContains(substrings ...string) BodyRetryMarkers {
+	return BodyRetryMarkers(substrings)
+}
+
+// 下载的限速, 每秒字节数
+type BandwidthLimit int64
+
+// WithBandwidthLimit 下载(Upload)时限速, 每秒最多读取 bytesPerSec 字节
+func WithBandwidthLimit(bytesPerSec int64) BandwidthLimit {
+	return BandwidthLimit(bytesPerSec)
+}
+
+// 下载时每次读取的缓冲大小, 字节数
+type DownloadBufferSize int
+
+// 下载缓冲的默认大小与最小值
+const (
+	defaultDownloadBufferSize = 1024*100
+	minDownloadBufferSize = 1024*4
+)
+
+// WithDownloadBufferSize 设置下载(Upload)时的缓冲大小, 默认 100KB, 小于 4KB 时使用 4KB
+// 慢速网络或内存有限时可以调小, 高速网络可以调大减少读写次数
+func WithDownloadBufferSize(n int) DownloadBufferSize {
+	if n < minDownloadBufferSize {
+		n = minDownloadBufferSize
+	}
+	return DownloadBufferSize(n)
+}
+
+// 下载时是否不输出进度日志
+type DownloadSilent bool
+
+// SilentDownload 下载时不输出进度与结果日志, 结果见 Context.DownloadStat
+func SilentDownload() DownloadSilent {
+	return true
+}
+
 // Get 请求, 当请求失败或状态码是失败的则会先执行 ff 再回调
 func Get(url string, vs ...interface{}) (*Context,error){
 	if !isUrl(url) {
@@ -35,18 +139,9 @@ func Get(url string, vs ...interface{}) (*Context,error){
 	return	Req(request, vs...)
 }
 
-// POST 请求
-func Post(url string, data []byte, contentType string, vs ...interface{}) (*Context,error){
-	if !isUrl(url) {
-		return nil, UrlBad
-	}
-	request, err := http.NewRequest("POST", url, bytes.NewBuffer([]byte(data)))
-	if err != nil{
-		log.Println("err->", err)
-		return nil, err
-	}
-	request.Header.Set("Content-Type", contentType)
-	return	Req(request, vs...)
+// POST 请求, body 为 []byte、string 或 io.Reader, contentType 为空时根据body推断
+func Post(url string, body interface{}, contentType string, vs ...interface{}) (*Context,error){
+	return bodyRequest("POST", url, body, contentType, vs...)
 }
 
 // POST json 请求
@@ -63,26 +158,32 @@ func PostJson(url string, jsonStr string, vs ...interface{}) (*Context,error){
 	return	Req(request, vs...)
 }
 
-// Put
-func Put(url string, data []byte, contentType string, vs ...interface{}) (*Context,error){
-	if !isUrl(url) {
-		return nil, UrlBad
-	}
-	request, err := http.NewRequest("PUT", url, bytes.NewBuffer([]byte(data)))
-	if err != nil{
-		log.Println("err->", err)
-		return nil, err
-	}
-	request.Header.Set("Content-Type", contentType)
-	return	Req(request, vs...)
+// Put, body 见 Post, contentType 为空时根据body推断
+func Put(url string, body interface{}, contentType string, vs ...interface{}) (*Context,error){
+	return bodyRequest("PUT", url, body, contentType, vs...)
+}
+
+// Patch, body 见 Post, contentType 为空时根据body推断
+func Patch(url string, body interface{}, contentType string, vs ...interface{}) (*Context,error){
+	return bodyRequest("PATCH", url, body, contentType, vs...)
 }
 
 // Delete
 func Delete(url string, vs ...interface{}) (*Context,error){
+	return bodyRequest("DELETE", url, nil, "", vs...)
+}
+
+// DeleteWithBody 带body的 Delete, body 见 Post, Content-Type 根据body推断
+func DeleteWithBody(url string, body interface{}, vs ...interface{}) (*Context,error){
+	return bodyRequest("DELETE", url, body, "", vs...)
+}
+
+// Options
+func Options(url string, vs ...interface{}) (*Context,error){
 	if !isUrl(url) {
 		return nil, UrlBad
 	}
-	request, err := http.NewRequest("DELETE", url, nil)
+	request, err := http.NewRequest("OPTIONS", url, nil)
 	if err != nil{
 		log.Println("err->", err)
 		return nil, err
@@ -90,31 +191,70 @@ func Delete(url string, vs ...interface{}) (*Context,error){
 	return	Req(request, vs...)
 }
 
-// Options
-func Options(url string, vs ...interface{}) (*Context,error){
+
+// Request 请求, body 见 Post, contentType 为空时根据body推断
+func Request(url, method string, body interface{}, contentType string, vs ...interface{}) (*Context,error){
+	return bodyRequest(method, url, body, contentType, vs...)
+}
+
+// bodyRequest 带body的请求, body 读到内存, 保证重试时可以重新发送
+// body 为 nil 时不带body, 也不设置 Content-Type
+func bodyRequest(method, url string, body interface{}, contentType string, vs ...interface{}) (*Context,error){
 	if !isUrl(url) {
 		return nil, UrlBad
 	}
-	request, err := http.NewRequest("OPTIONS", url, nil)
+	var data []byte
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		data = b
+	case string:
+		data = []byte(b)
+	case io.Reader:
+		var err error
+		if data, err = ioutil.ReadAll(b); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("body type %T is not []byte, string or io.Reader", body)
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequest(method, url, reader)
 	if err != nil{
 		log.Println("err->", err)
 		return nil, err
 	}
+	if body != nil || contentType != "" {
+		request.Header.Set("Content-Type", inferContentType(data, contentType))
+	}
 	return	Req(request, vs...)
 }
 
-
-// Request 请求
-func Request(url, method string, data []byte, contentType string, vs ...interface{}) (*Context,error){
+// NewRequest 任意method的请求, 如 PROPFIND 等自定义的method
+// body 会先读到内存, 保证重试时可以重新发送; 非幂等的method需要 RetryNonIdempotent() 才会自动重试
+func NewRequest(method, url string, body io.Reader, vs ...interface{}) (*Context,error){
 	if !isUrl(url) {
 		return nil, UrlBad
 	}
-	request, err := http.NewRequest(method, url, bytes.NewBuffer([]byte(data)))
+	if body != nil {
+		switch body.(type) {
+		case *bytes.Buffer, *bytes.Reader, *strings.Reader:
+		default:
+			b, err := ioutil.ReadAll(body)
+			if err != nil {
+				return nil, err
+			}
+			body = bytes.NewReader(b)
+		}
+	}
+	request, err := http.NewRequest(method, url, body)
 	if err != nil{
 		log.Println("err->", err)
 		return nil, err
 	}
-	request.Header.Set("Content-Type", contentType)
 	return	Req(request, vs...)
 }
 
@@ -123,7 +263,7 @@ func Upload(url, savePath string, vs ...interface{})  error {
 	if !isUrl(url) {
 		return UrlBad
 	}
-	c,err := Get(url,vs)
+	c,err := Get(url,vs...)
 	if err != nil{
 		return err
 	}
@@ -131,6 +271,44 @@ func Upload(url, savePath string, vs ...interface{})  error {
 	return nil
 }
 
+// inferContentType contentType 为空时根据body推断: json、表单(a=1&b=2), 其他使用 http.DetectContentType
+func inferContentType(data []byte, contentType string) string {
+	if contentType != "" {
+		return contentType
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+		return "application/json; charset=UTF-8"
+	}
+	if len(trimmed) > 0 && bytes.Contains(trimmed, []byte("=")) && !bytes.ContainsAny(trimmed, " \r\n") {
+		if _, err := url.ParseQuery(string(trimmed)); err == nil {
+			return "application/x-www-form-urlencoded"
+		}
+	}
+	return http.DetectContentType(data)
+}
+
+// copyClient 复制 Client 与 Transport
+func copyClient(client *http.Client) *http.Client {
+	cl := *client
+	switch t := cl.Transport.(type) {
+	case nil:
+		cl.Transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		cl.Transport = t.Clone()
+	}
+	return &cl
+}
+
+// httpTransport 获取 Client 的 *http.Transport
+func httpTransport(client *http.Client) (*http.Transport, error) {
+	t, ok := client.Transport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("client transport is not *http.Transport")
+	}
+	return t, nil
+}
+
 // isUrl 验证是否是有效的 url
 func isUrl(url string) bool {
 	if url == ""{
@@ -157,8 +335,24 @@ func Req(request *http.Request, vs ...interface{}) (*Context,error){
 		failed FailedFunc
 		retry RetryFunc
 		end EndFunc
+		file FileFunc
+		fallback FallbackFunc
 		reqTimeOut ReqTimeOut
 		reqTimeOutMs ReqTimeOutMs
+		readTimeOut time.Duration
+		teeDir TeeDir
+		teeGzip TeeGzip
+		reqFuncs []ReqFunc
+		stats *Stats
+		retryNonIdempotent NonIdempotentRetry
+		sameHostRedirect SameHostRedirect
+		silentDownload DownloadSilent
+		bandwidth BandwidthLimit
+		bufferSize DownloadBufferSize
+		bodyRetry BodyRetryMarkers
+		singleFlight SingleFlight
+		clientFuncs []ClientFunc
+		contextFuncs []ContextFunc
 	)
 
 	//添加默认的Header
@@ -169,7 +363,9 @@ func Req(request *http.Request, vs ...interface{}) (*Context,error){
 	for _, v := range vs {
 		switch vv := v.(type) {
 		case http.Header:
+			// 替换默认的同名header, 避免重复
 			for key, values := range vv {
+				request.Header.Del(key)
 				for _, value := range values {
 					request.Header.Add(key, value)
 				}
@@ -194,10 +390,44 @@ func Req(request *http.Request, vs ...interface{}) (*Context,error){
 			retry = vv
 		case EndFunc:
 			end = vv
+		case FileFunc:
+			file = vv
+		case FallbackFunc:
+			fallback = vv
 		case ReqTimeOut:
 			reqTimeOut = vv
 		case ReqTimeOutMs:
 			reqTimeOutMs = vv
+		case ReadTimeOut:
+			readTimeOut = time.Duration(vv) * time.Second
+		case ReadTimeOutMs:
+			readTimeOut = time.Duration(vv) * time.Millisecond
+		case TeeDir:
+			teeDir = vv
+		case TeeGzip:
+			teeGzip = vv
+		case ReqFunc:
+			reqFuncs = append(reqFuncs, vv)
+		case *Stats:
+			stats = vv
+		case NonIdempotentRetry:
+			retryNonIdempotent = vv
+		case SameHostRedirect:
+			sameHostRedirect = vv
+		case DownloadSilent:
+			silentDownload = vv
+		case BandwidthLimit:
+			bandwidth = vv
+		case DownloadBufferSize:
+			bufferSize = vv
+		case BodyRetryMarkers:
+			bodyRetry = append(bodyRetry, vv...)
+		case SingleFlight:
+			singleFlight = vv
+		case ClientFunc:
+			clientFuncs = append(clientFuncs, vv)
+		case ContextFunc:
+			contextFuncs = append(contextFuncs, vv)
 		}
 	}
 
@@ -217,8 +447,17 @@ func Req(request *http.Request, vs ...interface{}) (*Context,error){
 		client.Timeout =  time.Duration(reqTimeOutMs) * time.Millisecond
 	}
 
+	if len(clientFuncs) > 0 {
+		client = copyClient(client)
+		for _, f := range clientFuncs {
+			if err := f(client); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	// 创建对象
-	return &Context{
+	c := &Context{
 		Client: client,
 		Req : request,
 		times : 0,
@@ -229,7 +468,33 @@ func Req(request *http.Request, vs ...interface{}) (*Context,error){
 		FailedFunc: failed,
 		RetryFunc: retry,
 		EndFunc: end,
-	},nil
+		FileFunc: file,
+		FallbackFunc: fallback,
+		teeDir: teeDir,
+		teeGzip: bool(teeGzip),
+		readTimeOut: readTimeOut,
+		reqFuncs: reqFuncs,
+		stats: stats,
+		RetryNonIdempotent: bool(retryNonIdempotent),
+		silentDownload: bool(silentDownload),
+		bandwidth: int64(bandwidth),
+		bufferSize: int(bufferSize),
+		bodyRetry: bodyRetry,
+		singleFlight: bool(singleFlight),
+	}
+
+	c.baseClient = client
+	c.sameHost = bool(sameHostRedirect)
+	if sameHostRedirect {
+		c.sameHostRedirect()
+	}
+	c.detectRedirectLoop()
+
+	for _, f := range contextFuncs {
+		f(c)
+	}
+
+	return c, nil
 }
 
 
@@ -0,0 +1,115 @@
+package gathertool
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewRequest(t *testing.T) {
+	var methods, bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		methods = append(methods, r.Method)
+		bodies = append(bodies, string(b))
+		if len(methods) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	// io.MultiReader 不能重复读取, 需要 NewRequest 缓存后重试才能重新发送body
+	body := io.MultiReader(strings.NewReader(`<propfind>`), strings.NewReader(`</propfind>`))
+	c, err := NewRequest("PROPFIND", ts.URL, body, RetryNonIdempotent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+
+	if len(methods) != 2 || methods[0] != "PROPFIND" || methods[1] != "PROPFIND" {
+		t.Fatalf("methods = %v", methods)
+	}
+	for _, b := range bodies {
+		if b != "<propfind></propfind>" {
+			t.Fatalf("bodies = %q", bodies)
+		}
+	}
+}
+
+func TestPostRetryBody(t *testing.T) {
+	var bodies, types []string
+	hits := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, r.Method+" "+string(b))
+		types = append(types, r.Header.Get("Content-Type"))
+		// 每个method第一次请求失败
+		if hits[r.Method]++; hits[r.Method] == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		new  func() (*Context, error)
+		body string
+		typ  string
+	}{
+		{func() (*Context, error) {
+			return Post(ts.URL, []byte(`{"id":1}`), "", RetryNonIdempotent(), RetryFunc(func(c *Context) {}))
+		}, `POST {"id":1}`, "application/json; charset=UTF-8"},
+		// 流式的 io.Reader 先读到内存, 重试时重新发送
+		{func() (*Context, error) {
+			return Patch(ts.URL, ioutil.NopCloser(strings.NewReader("a=1&b=2")), "", RetryNonIdempotent(), RetryFunc(func(c *Context) {}))
+		}, "PATCH a=1&b=2", "application/x-www-form-urlencoded"},
+		{func() (*Context, error) {
+			return Put(ts.URL, "<html></html>", "", RetryFunc(func(c *Context) {}))
+		}, "PUT <html></html>", "text/html; charset=utf-8"},
+		{func() (*Context, error) {
+			return DeleteWithBody(ts.URL, `{"ids":[1,2]}`, RetryFunc(func(c *Context) {}))
+		}, `DELETE {"ids":[1,2]}`, "application/json; charset=UTF-8"},
+	}
+	for _, cs := range cases {
+		bodies, types = nil, nil
+		c, err := cs.new()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Do()
+		if len(bodies) != 2 || bodies[0] != cs.body || bodies[1] != cs.body || types[1] != cs.typ {
+			t.Fatalf("bodies = %q, types = %q", bodies, types)
+		}
+	}
+
+	// 没有body的 Delete 不设置 Content-Type
+	bodies, types = nil, nil
+	c, _ := Delete(ts.URL, RetryTimes(3))
+	c.Do()
+	if len(bodies) != 1 || bodies[0] != "DELETE " || types[0] != "" {
+		t.Fatalf("bodies = %q, types = %q", bodies, types)
+	}
+	if _, err := Post(ts.URL, 1, ""); err == nil {
+		t.Fatal("expected error for unsupported body type")
+	}
+}
+
+func TestInferContentType(t *testing.T) {
+	cases := map[string]string{
+		`[1, 2]`:          "application/json; charset=UTF-8",
+		`{bad json`:       "text/plain; charset=utf-8",
+		"q=go&page=2":     "application/x-www-form-urlencoded",
+		"<html></html>":   "text/html; charset=utf-8",
+		"hello world a=b": "text/plain; charset=utf-8",
+	}
+	for body, want := range cases {
+		if got := inferContentType([]byte(body), ""); got != want {
+			t.Errorf("inferContentType(%q) = %q, want %q", body, got, want)
+		}
+	}
+	if got := inferContentType([]byte("{}"), "text/plain"); got != "text/plain" {
+		t.Fatalf("contentType = %q", got)
+	}
+}
@@ -0,0 +1,182 @@
+package gathertool
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotateWriter 按大小或时间切分的输出文件
+// 当前文件超过 MaxSize 或打开超过 Window 后, 下一次写入时新建文件
+// 文件名为 路径去掉扩展名_时间_序号.扩展名, 如 data.csv -> data_20210429150405_1.csv
+// 每次 Write 的内容写入同一个文件, 按记录写入时一条记录不会被分到两个文件
+type RotateWriter struct {
+	Path string
+
+	// 单个文件的最大字节数, 0 不限制
+	MaxSize int64
+
+	// 单个文件的时间窗口, 如 time.Hour, 0 不限制
+	Window time.Duration
+
+	// 每个新文件开头写入的内容, 如 csv 的 BOM 与表头
+	Header []byte
+
+	// 每写入多少次 fsync 一次, 0 不主动 fsync, 见 SetSyncEvery
+	syncEvery int
+	writes    int
+
+	mux    sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+	index  int
+	files  []string
+}
+
+// NewRotateWriter 新建按大小或时间切分的输出文件
+func NewRotateWriter(path string, maxSize int64, window time.Duration) *RotateWriter {
+	return &RotateWriter{
+		Path:    path,
+		MaxSize: maxSize,
+		Window:  window,
+	}
+}
+
+// Write 写入内容, 需要时先切换到新文件
+func (r *RotateWriter) Write(p []byte) (int, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.f == nil || r.needRotate() {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	if err != nil {
+		return n, err
+	}
+	r.writes++
+	if r.syncEvery > 0 && r.writes%r.syncEvery == 0 {
+		err = r.f.Sync()
+	}
+	return n, err
+}
+
+// SetSyncEvery 每写入 n 次(RotateCsv.Add、WriteJson 每行一次) fsync 一次, 机器宕机时最多丢失 n 行
+// 写入不经过缓存, 进程崩溃不会丢数据; n 越小写入越慢, n <= 0 不主动 fsync
+func (r *RotateWriter) SetSyncEvery(n int) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.syncEvery = n
+}
+
+// WriteJson 写入一行json(NDJSON)
+func (r *RotateWriter) WriteJson(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = r.Write(append(b, '\n'))
+	return err
+}
+
+// Files 已创建的文件
+func (r *RotateWriter) Files() []string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return append([]string{}, r.files...)
+}
+
+// Close 关闭当前文件
+func (r *RotateWriter) Close() error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+func (r *RotateWriter) needRotate() bool {
+	if r.MaxSize > 0 && r.size >= r.MaxSize {
+		return true
+	}
+	return r.Window > 0 && time.Since(r.opened) >= r.Window
+}
+
+// rotate 关闭当前文件, 新建下一个文件
+func (r *RotateWriter) rotate() error {
+	if r.f != nil {
+		if err := r.f.Close(); err != nil {
+			loger("rotate close fail : ", err)
+		}
+		r.f = nil
+	}
+	if dir := filepath.Dir(r.Path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	r.index++
+	ext := filepath.Ext(r.Path)
+	name := fmt.Sprintf("%s_%s_%d%s", strings.TrimSuffix(r.Path, ext), time.Now().Format("20060102150405"), r.index, ext)
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	r.f = f
+	r.size = 0
+	r.opened = time.Now()
+	r.files = append(r.files, name)
+	if len(r.Header) > 0 {
+		n, err := f.Write(r.Header)
+		r.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RotateCsv 按大小或时间切分的csv文件, 每个文件都带 UTF-8 BOM 与表头
+type RotateCsv struct {
+	*RotateWriter
+}
+
+// NewRotateCsv 新建按大小或时间切分的csv文件, header 为每个文件的表头, 可以为空
+func NewRotateCsv(path string, maxSize int64, window time.Duration, header []string) (*RotateCsv, error) {
+	var buf bytes.Buffer
+	buf.WriteString("\xEF\xBB\xBF")
+	if len(header) > 0 {
+		w := csv.NewWriter(&buf)
+		if err := w.Write(header); err != nil {
+			return nil, err
+		}
+		w.Flush()
+	}
+	rw := NewRotateWriter(path, maxSize, window)
+	rw.Header = buf.Bytes()
+	return &RotateCsv{rw}, nil
+}
+
+// Add 写入一行
+func (c *RotateCsv) Add(data []string) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(data); err != nil {
+		return err
+	}
+	w.Flush()
+	_, err := c.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,109 @@
+package gathertool
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotateCsv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// BOM 3 + 表头 "name,age\n" 9 + 每行 "a0,10\n" 6, 第一个文件写入3行后达到 30 字节
+	w, err := NewRotateCsv(filepath.Join(dir, "data.csv"), 30, 0, []string{"name", "age"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := w.Add([]string{fmt.Sprintf("a%d", i), fmt.Sprintf("1%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := w.Files()
+	if len(files) != 2 {
+		t.Fatalf("files = %v", files)
+	}
+	want := [][]string{{"a0", "a1", "a2"}, {"a3", "a4"}}
+	for i, name := range files {
+		if !strings.HasPrefix(filepath.Base(name), "data_") || filepath.Ext(name) != ".csv" {
+			t.Fatalf("file name = %s", name)
+		}
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(b), "\xEF\xBB\xBF"))).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != len(want[i])+1 || rows[0][0] != "name" {
+			t.Fatalf("file %d rows = %v", i, rows)
+		}
+		for j, name := range want[i] {
+			if rows[j+1][0] != name {
+				t.Fatalf("file %d rows = %v", i, rows)
+			}
+		}
+	}
+}
+
+func TestRotateWriterJson(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := NewRotateWriter(filepath.Join(dir, "data.ndjson"), 1, 0)
+	defer w.Close()
+	for i := 0; i < 3; i++ {
+		if err := w.WriteJson(map[string]int{"i": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := w.Files()
+	if len(files) != 3 {
+		t.Fatalf("files = %v", files)
+	}
+	b, _ := ioutil.ReadFile(files[2])
+	if string(b) != "{\"i\":2}\n" {
+		t.Fatalf("last file = %q", b)
+	}
+}
+
+func TestRotateWriterSyncEvery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := NewRotateWriter(filepath.Join(dir, "data.json"), 0, 0)
+	w.SetSyncEvery(1)
+	for i := 0; i < 3; i++ {
+		if err := w.WriteJson(map[string]int{"id": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 不调用 Close, 已写入的行都在文件中
+	b, err := ioutil.ReadFile(w.Files()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "{\"id\":0}\n{\"id\":1}\n{\"id\":2}\n" {
+		t.Fatalf("data = %q", b)
+	}
+	w.Close()
+}
@@ -0,0 +1,256 @@
+package gathertool
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scheduler 定时执行抓取, 用于监控类的爬虫
+// 按固定间隔(NewScheduler)或cron表达式(NewCronScheduler)执行 fn, fn 中执行一次完整的抓取(如 StartJobGet)
+// 上一次还没有执行完时, 默认跳过本次, Queue 为 true 时在上一次完成后再执行一次(最多排队一次)
+type Scheduler struct {
+	// 上一次还没有执行完时是否排队执行
+	Queue bool
+
+	fn   func() error
+	next func(t time.Time) time.Time
+
+	mux     sync.Mutex
+	running bool
+	pending bool
+	stopped bool
+	runs    int
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewScheduler 每隔 interval 执行一次 fn, Start 后第一次在 interval 后执行
+func NewScheduler(interval time.Duration, fn func() error) *Scheduler {
+	return &Scheduler{
+		fn:   fn,
+		next: func(t time.Time) time.Time { return t.Add(interval) },
+	}
+}
+
+// NewCronScheduler 按cron表达式执行 fn
+// 支持5个字段 "分 时 日 月 周", 字段支持 *、数字、a-b、a,b 与 /n, 周的0和7为周日; 日与周都不是 * 时满足任一即可
+// 也支持 @every 30s(time.ParseDuration 的格式)、@hourly、@daily、@weekly、@monthly
+func NewCronScheduler(spec string, fn func() error) (*Scheduler, error) {
+	next, err := parseCron(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &Scheduler{fn: fn, next: next}, nil
+}
+
+// Start 开始定时执行
+func (s *Scheduler) Start() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+	s.stopped = false
+	s.wg.Add(1)
+	go s.loop(s.stop)
+}
+
+// Stop 停止定时执行, 等待正在执行的抓取完成, 排队的不再执行
+func (s *Scheduler) Stop() {
+	s.mux.Lock()
+	if s.stop == nil {
+		s.mux.Unlock()
+		return
+	}
+	close(s.stop)
+	s.stop = nil
+	s.stopped = true
+	s.pending = false
+	s.mux.Unlock()
+	s.wg.Wait()
+}
+
+// Runs 已执行的次数
+func (s *Scheduler) Runs() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.runs
+}
+
+func (s *Scheduler) loop(stop chan struct{}) {
+	defer s.wg.Done()
+	for {
+		timer := time.NewTimer(time.Until(s.next(time.Now())))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.trigger()
+		}
+	}
+}
+
+// trigger 到了执行时间, 上一次还在执行时跳过或排队
+func (s *Scheduler) trigger() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.running {
+		if s.Queue {
+			s.pending = true
+		} else {
+			log.Println("[Scheduler] 上一次抓取还没有完成, 跳过本次")
+		}
+		return
+	}
+	s.running = true
+	s.wg.Add(1)
+	go s.run()
+}
+
+func (s *Scheduler) run() {
+	defer s.wg.Done()
+	for {
+		if err := s.fn(); err != nil {
+			log.Println("[Scheduler] 抓取失败 : ", err)
+		}
+		s.mux.Lock()
+		s.runs++
+		if s.pending && !s.stopped {
+			s.pending = false
+			s.mux.Unlock()
+			continue
+		}
+		s.running = false
+		s.mux.Unlock()
+		return
+	}
+}
+
+// cronField cron表达式的一个字段, 第i位为1表示i满足
+type cronField uint64
+
+func (f cronField) has(i int) bool {
+	return f&(1<<uint(i)) != 0
+}
+
+// parseCron 解析cron表达式, 返回计算下一次执行时间的方法
+func parseCron(spec string) (func(t time.Time) time.Time, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, err
+		}
+		if d <= 0 {
+			return nil, errors.New("cron interval must be positive.")
+		}
+		return func(t time.Time) time.Time { return t.Add(d) }, nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q : need 5 fields", spec)
+	}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	var set [5]cronField
+	for i, field := range fields {
+		f, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("cron %q : %v", spec, err)
+		}
+		set[i] = f
+	}
+	minute, hour, dom, month, dow := set[0], set[1], set[2], set[3], set[4]
+	if dow.has(7) {
+		dow |= 1
+	}
+	domAll, dowAll := fields[2] == "*", fields[4] == "*"
+	dayMatch := func(t time.Time) bool {
+		switch {
+		case domAll && dowAll:
+			return true
+		case domAll:
+			return dow.has(int(t.Weekday()))
+		case dowAll:
+			return dom.has(t.Day())
+		}
+		return dom.has(t.Day()) || dow.has(int(t.Weekday()))
+	}
+
+	return func(t time.Time) time.Time {
+		t = t.Truncate(time.Minute).Add(time.Minute)
+		// 最多查找5年, 如 2月30日 这样永远不会满足的表达式返回5年后
+		end := t.AddDate(5, 0, 0)
+		for t.Before(end) {
+			switch {
+			case !month.has(int(t.Month())):
+				t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			case !dayMatch(t):
+				t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			case !hour.has(t.Hour()):
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			case !minute.has(t.Minute()):
+				t = t.Add(time.Minute)
+			default:
+				return t
+			}
+		}
+		return end
+	}, nil
+}
+
+// parseCronField 解析cron的一个字段, 如 "*/15"、"1-5"、"0,30"
+func parseCronField(field string, min, max int) (cronField, error) {
+	var f cronField
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step %q", part)
+			}
+			step = n
+			part = part[:i]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			r := strings.SplitN(part, "-", 2)
+			n, err := strconv.Atoi(r[0])
+			if err != nil {
+				return 0, fmt.Errorf("bad value %q", part)
+			}
+			lo, hi = n, n
+			if len(r) == 2 {
+				if hi, err = strconv.Atoi(r[1]); err != nil {
+					return 0, fmt.Errorf("bad value %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("value %q out of range %d-%d", part, min, max)
+		}
+		for i := lo; i <= hi; i += step {
+			f |= 1 << uint(i)
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,64 @@
+package gathertool
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	var runs int32
+	s := NewScheduler(50*time.Millisecond, func() error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	})
+	s.Start()
+	time.Sleep(280 * time.Millisecond)
+	s.Stop()
+	n := atomic.LoadInt32(&runs)
+	if n < 3 || int(n) != s.Runs() {
+		t.Fatalf("runs = %d, Runs() = %d", n, s.Runs())
+	}
+	time.Sleep(120 * time.Millisecond)
+	if atomic.LoadInt32(&runs) != n {
+		t.Fatal("scheduler runs after Stop")
+	}
+
+	// 上一次没有完成时跳过
+	s = NewScheduler(20*time.Millisecond, func() error {
+		time.Sleep(200 * time.Millisecond)
+		return nil
+	})
+	s.Start()
+	time.Sleep(150 * time.Millisecond)
+	s.Stop()
+	if s.Runs() != 1 {
+		t.Fatalf("overlapping runs = %d", s.Runs())
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	base := time.Date(2021, 5, 7, 10, 17, 30, 0, time.UTC) // 周五
+	cases := map[string]time.Time{
+		"*/15 * * * *":   time.Date(2021, 5, 7, 10, 30, 0, 0, time.UTC),
+		"0 9-18 * * 1-5": time.Date(2021, 5, 7, 11, 0, 0, 0, time.UTC),
+		"30 2 * * 0":     time.Date(2021, 5, 9, 2, 30, 0, 0, time.UTC),
+		"0 0 1 6 *":      time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+		"@daily":         time.Date(2021, 5, 8, 0, 0, 0, 0, time.UTC),
+		"@every 90s":     base.Add(90 * time.Second),
+	}
+	for spec, want := range cases {
+		next, err := parseCron(spec)
+		if err != nil {
+			t.Fatal(spec, err)
+		}
+		if got := next(base); !got.Equal(want) {
+			t.Errorf("%s next = %v, want %v", spec, got, want)
+		}
+	}
+	for _, spec := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("%s expected error", spec)
+		}
+	}
+}
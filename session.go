@@ -0,0 +1,59 @@
+package gathertool
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"time"
+)
+
+// Session 会话, 请求共用同一个 Client 与 cookie jar, 登录后的请求自动带上登录的cookie
+type Session struct {
+	Client *http.Client
+}
+
+// NewSession 新建会话
+func NewSession() *Session {
+	jar, _ := cookiejar.New(nil)
+	return &Session{
+		Client: &http.Client{
+			Timeout: 60*time.Second,
+			Jar:     jar,
+		},
+	}
+}
+
+// Get 使用会话的 Client 请求
+func (s *Session) Get(url string, vs ...interface{}) (*Context, error) {
+	return Get(url, append(vs, s.Client)...)
+}
+
+// Post 使用会话的 Client 请求, body 见 Post
+func (s *Session) Post(url string, data interface{}, contentType string, vs ...interface{}) (*Context, error) {
+	return Post(url, data, contentType, append(vs, s.Client)...)
+}
+
+// PostJson 使用会话的 Client 请求
+func (s *Session) PostJson(url string, jsonStr string, vs ...interface{}) (*Context, error) {
+	return PostJson(url, jsonStr, append(vs, s.Client)...)
+}
+
+// Cookies 会话中发送到该url的cookie
+func (s *Session) Cookies(rawUrl string) []*http.Cookie {
+	u, err := url.Parse(rawUrl)
+	if err != nil || s.Client.Jar == nil {
+		return nil
+	}
+	return s.Client.Jar.Cookies(u)
+}
+
+// LoginAndCrawl 先登录再并发抓取
+// loginFn 使用会话登录, 返回错误则不抓取; 登录后所有并发共用会话的 Client, 请求都带上登录的cookie
+// vs 为 StartJobGet 的可变参数, 如 SucceedFunc, FailedFunc, ProgressFunc; 传入的 *http.Client 不生效
+func LoginAndCrawl(loginFn func(s *Session) error, queue TodoQueue, workers int, vs ...interface{}) error {
+	s := NewSession()
+	if err := loginFn(s); err != nil {
+		return err
+	}
+	return StartJobGet(workers, queue, append(vs, s.Client)...)
+}
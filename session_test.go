@@ -0,0 +1,63 @@
+package gathertool
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLoginAndCrawl(t *testing.T) {
+	var withCookie, withoutCookie int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			if r.FormValue("user") != "mange" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "abc", Path: "/"})
+			return
+		}
+		if c, err := r.Cookie("sid"); err == nil && c.Value == "abc" {
+			atomic.AddInt32(&withCookie, 1)
+			fmt.Fprint(w, "ok")
+			return
+		}
+		atomic.AddInt32(&withoutCookie, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	queue := NewQueue()
+	for i := 0; i < 9; i++ {
+		_ = queue.Add(&Task{Url: fmt.Sprintf("%s/page/%d", ts.URL, i)})
+	}
+
+	var succeed int32
+	err := LoginAndCrawl(func(s *Session) error {
+		c, err := s.Post(ts.URL+"/login", []byte("user=mange"), "application/x-www-form-urlencoded")
+		if err != nil {
+			return err
+		}
+		c.Do()
+		if len(s.Cookies(ts.URL)) == 0 {
+			return errors.New("login fail")
+		}
+		return nil
+	}, queue, 3, SucceedFunc(func(c *Context) {
+		atomic.AddInt32(&succeed, 1)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if withCookie != 9 || withoutCookie != 0 || succeed != 9 {
+		t.Fatalf("with cookie = %d, without cookie = %d, succeed = %d", withCookie, withoutCookie, succeed)
+	}
+
+	loginErr := errors.New("bad password")
+	if err := LoginAndCrawl(func(s *Session) error { return loginErr }, NewQueue(), 1); err != loginErr {
+		t.Fatalf("err = %v", err)
+	}
+}
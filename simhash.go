@@ -0,0 +1,48 @@
+package gathertool
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+)
+
+// SimHash 计算文本的 SimHash 指纹, 相似的文本指纹的汉明距离小, 用于判断近似重复的页面(如模板页、镜像内容)
+// 文本先经过 NormalizeText 与转小写, 以连续3个字符为特征, 中英文都适用
+// 一般汉明距离 <= 3 可以认为是近似重复, 文本越短越不准确
+func SimHash(text string) uint64 {
+	runes := []rune(strings.ToLower(NormalizeText(text, StripZeroWidth)))
+	if len(runes) == 0 {
+		return 0
+	}
+	const shingle = 3
+	var weights [64]int
+	h := fnv.New64a()
+	for i := 0; i+shingle <= len(runes) || i == 0; i++ {
+		end := i + shingle
+		if end > len(runes) {
+			end = len(runes)
+		}
+		h.Reset()
+		_, _ = h.Write([]byte(string(runes[i:end])))
+		sum := h.Sum64()
+		for b := 0; b < 64; b++ {
+			if sum&(1<<uint(b)) != 0 {
+				weights[b]++
+			} else {
+				weights[b]--
+			}
+		}
+	}
+	var fingerprint uint64
+	for b := 0; b < 64; b++ {
+		if weights[b] > 0 {
+			fingerprint |= 1 << uint(b)
+		}
+	}
+	return fingerprint
+}
+
+// HammingDistance 两个指纹不同的位数, 0-64
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,19 @@
+package gathertool
+
+import "testing"
+
+func TestSimHash(t *testing.T) {
+	a := "gathertool 是轻量级的爬虫库, 支持并发抓取、重试、代理与任务队列, 抓取的数据可以保存到 mysql、csv 或 parquet 文件。"
+	b := "gathertool 是轻量级的爬虫库, 支持并发抓取、重试、代理与任务队列, 抓取的数据可以保存到 mysql、csv 或 parquet 文件!"
+	c := "The quick brown fox jumps over the lazy dog while the weather report says it will rain all weekend long."
+
+	if d := HammingDistance(SimHash(a), SimHash(b)); d > 3 {
+		t.Fatalf("near-identical distance = %d", d)
+	}
+	if d := HammingDistance(SimHash(a), SimHash(c)); d < 16 {
+		t.Fatalf("dissimilar distance = %d", d)
+	}
+	if HammingDistance(SimHash(a), SimHash(a)) != 0 || HammingDistance(0, 7) != 3 {
+		t.Fatal("HammingDistance")
+	}
+}
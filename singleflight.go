@@ -0,0 +1,54 @@
+package gathertool
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// 是否合并同时进行的相同GET请求, 见 WithSingleFlight
+type SingleFlight bool
+
+// WithSingleFlight 同时进行的相同url(CanonicalURL)的GET请求只发送一次, 共用响应
+// 用于去重不完全的并发抓取, 合并的请求认为是等价的, 不比较请求头与cookie
+// 合并的请求在发送时读取完body, ReadTimeOut 不生效, 由 Client 的超时限制
+func WithSingleFlight() SingleFlight {
+	return true
+}
+
+var flightGroup singleflight.Group
+
+// flightResp 共用的响应, body 已读取
+type flightResp struct {
+	resp *http.Response
+	body []byte
+}
+
+// send 发送请求, 开启 WithSingleFlight 的GET请求合并相同url的请求
+func (c *Context) send() (*http.Response, error) {
+	if !c.singleFlight || c.Req.Method != http.MethodGet {
+		return c.Client.Do(c.Req)
+	}
+	v, err, _ := flightGroup.Do(CanonicalURL(c.Req.URL.String()), func() (interface{}, error) {
+		resp, err := c.Client.Do(c.Req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return &flightResp{resp: resp, body: body}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	fr := v.(*flightResp)
+	resp := *fr.resp
+	resp.Header = fr.resp.Header.Clone()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(fr.body))
+	return &resp, nil
+}
@@ -0,0 +1,41 @@
+package gathertool
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithSingleFlight(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprint(w, "shared")
+	}))
+	defer ts.Close()
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 2)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c, err := Get(ts.URL+"/a?x=1", WithSingleFlight())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			c.Do()
+			bodies[i] = string(c.RespBody)
+		}(i)
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&hits); n != 1 || bodies[0] != "shared" || bodies[1] != "shared" {
+		t.Fatalf("hits = %d, bodies = %q", n, bodies)
+	}
+}
@@ -0,0 +1,56 @@
+package gathertool
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// SitemapsFromRobots 请求 robots.txt, 返回其中 Sitemap: 声明的地址
+// 相对地址按 robots.txt 的地址转为绝对地址, 重复的地址只返回一次
+func SitemapsFromRobots(robotsURL string, vs ...interface{}) ([]string, error) {
+	base, err := url.Parse(robotsURL)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Get(robotsURL, vs...)
+	if err != nil {
+		return nil, err
+	}
+	c.Do()
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	if c.Resp == nil || StatusCodeMap[c.Resp.StatusCode] != "success" {
+		return nil, errors.New("robots.txt request fail.")
+	}
+	return parseRobotsSitemaps(base, c.RespBody), nil
+}
+
+// parseRobotsSitemaps 解析 robots.txt 中的 Sitemap: 行, 不区分大小写
+func parseRobotsSitemaps(base *url.URL, body []byte) []string {
+	list := make([]string, 0)
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.Index(line, ":")
+		if i < 0 || !strings.EqualFold(strings.TrimSpace(line[:i]), "sitemap") {
+			continue
+		}
+		u, err := base.Parse(strings.TrimSpace(line[i+1:]))
+		if err != nil || u.Host == "" {
+			continue
+		}
+		if !seen[u.String()] {
+			seen[u.String()] = true
+			list = append(list, u.String())
+		}
+	}
+	return list
+}
@@ -0,0 +1,33 @@
+package gathertool
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSitemapsFromRobots(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/robots.txt" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, "User-agent: *\nDisallow: /admin\n\nSitemap: https://example.com/sitemap.xml\n"+
+			"sitemap: /sitemap-news.xml # 新闻\nSitemap: https://example.com/sitemap.xml\n")
+	}))
+	defer ts.Close()
+
+	list, err := SitemapsFromRobots(ts.URL + "/robots.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://example.com/sitemap.xml", ts.URL + "/sitemap-news.xml"}
+	if fmt.Sprint(list) != fmt.Sprint(want) {
+		t.Fatalf("sitemaps = %v", list)
+	}
+
+	if _, err := SitemapsFromRobots(ts.URL + "/none/robots.txt"); err == nil {
+		t.Fatal("expected error for missing robots.txt")
+	}
+}
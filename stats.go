@@ -0,0 +1,490 @@
+/*
+	Description : 请求统计
+	Author : ManGe
+	Version : v0.1
+	Date : 2021-04-29
+*/
+
+package gathertool
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http/httptrace"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stats 请求统计, 作为请求的可变参数传入后每次请求(包括重试)都会被统计
+// 零值可以直接使用, 使用默认的分布区间; Snapshot 返回的副本可以按值传递
+type Stats struct {
+	mux *sync.Mutex
+
+	// 请求次数, 包括重试
+	Count int64
+
+	// 请求失败(没有响应)的次数
+	ErrCount int64
+
+	// 完成的请求数(重试只计一次)与其中成功(执行了成功事件)的请求数
+	Pages        int64
+	SuccessCount int64
+
+	// 状态码分布
+	Code map[int]int64
+
+	// 响应时间累加
+	SumMs time.Duration
+
+	// 首字节时间累加
+	SumTTFB time.Duration
+
+	// 响应body大小累加
+	SumBytes int64
+
+	// DNS解析、建立连接、TLS握手的时间累加与次数, 连接复用的请求不计
+	SumDNS       time.Duration
+	DNSCount     int64
+	SumConnect   time.Duration
+	ConnectCount int64
+	SumTLS       time.Duration
+	TLSCount     int64
+
+	// 分布区间与每个区间的数量
+	sizeBuckets    []int64
+	sizeCounts     []int64
+	latencyBuckets []time.Duration
+	latencyCounts  []int64
+
+	// 最慢的请求, 按响应时间从大到小, 最多 statsSlowest 个
+	slowest []slowUrl
+
+	// 第一个请求开始与最后一个请求结束的时间
+	start time.Time
+	end   time.Time
+}
+
+// 报告中最慢请求的数量
+const statsSlowest = 10
+
+// slowUrl 响应时间较长的请求
+type slowUrl struct {
+	Url string
+	Ms  time.Duration
+}
+
+// 默认的响应大小分布区间
+var DefaultSizeBuckets = []int64{1 << 10, 10 << 10, 100 << 10, 1 << 20, 10 << 20}
+
+// 默认的响应时间分布区间
+var DefaultLatencyBuckets = []time.Duration{
+	50 * time.Millisecond, 100 * time.Millisecond, 200 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2 * time.Second, 5 * time.Second,
+}
+
+// NewStats 新建请求统计
+func NewStats() *Stats {
+	s := &Stats{
+		Code: make(map[int]int64),
+	}
+	s.SetBuckets(DefaultSizeBuckets, DefaultLatencyBuckets)
+	return s
+}
+
+// SetBuckets 设置响应大小与响应时间的分布区间, 每个值为区间的上限(包含), 需从小到大
+// 设置后重新开始计数
+func (s *Stats) SetBuckets(size []int64, latency []time.Duration) {
+	s.lock().Lock()
+	defer s.mux.Unlock()
+	s.sizeBuckets = append([]int64{}, size...)
+	s.sizeCounts = make([]int64, len(size)+1)
+	s.latencyBuckets = append([]time.Duration{}, latency...)
+	s.latencyCounts = make([]int64, len(latency)+1)
+}
+
+// Histogram 响应大小与响应时间的分布
+// Counts 比 Buckets 多一个, Counts[i] 为 (Buckets[i-1], Buckets[i]] 区间的数量, 最后一个为超过最大区间的数量
+type Histogram struct {
+	SizeBuckets    []int64
+	SizeCounts     []int64
+	LatencyBuckets []time.Duration
+	LatencyCounts  []int64
+}
+
+// Histogram 获取响应大小与响应时间的分布
+func (s *Stats) Histogram() Histogram {
+	s.lock().Lock()
+	defer s.mux.Unlock()
+	return Histogram{
+		SizeBuckets:    append([]int64{}, s.sizeBuckets...),
+		SizeCounts:     append([]int64{}, s.sizeCounts...),
+		LatencyBuckets: append([]time.Duration{}, s.latencyBuckets...),
+		LatencyCounts:  append([]int64{}, s.latencyCounts...),
+	}
+}
+
+// Add 统计一次请求
+func (s *Stats) Add(c *Context) {
+	s.lock().Lock()
+	defer s.mux.Unlock()
+	s.init()
+	s.Count++
+	if c.Resp != nil {
+		s.Code[c.Resp.StatusCode]++
+	} else {
+		s.ErrCount++
+	}
+	s.SumMs += c.Ms
+	now := time.Now()
+	if start := now.Add(-c.Ms); s.start.IsZero() || start.Before(s.start) {
+		s.start = start
+	}
+	if now.After(s.end) {
+		s.end = now
+	}
+	s.addSlowest(c)
+	s.SumTTFB += c.TTFB
+	c.timingMux.Lock()
+	timing := c.Timing
+	c.timingMux.Unlock()
+	if timing.DNS > 0 {
+		s.SumDNS += timing.DNS
+		s.DNSCount++
+	}
+	if timing.Connect > 0 {
+		s.SumConnect += timing.Connect
+		s.ConnectCount++
+	}
+	if timing.TLS > 0 {
+		s.SumTLS += timing.TLS
+		s.TLSCount++
+	}
+
+	size := int64(len(c.RespBody))
+	s.SumBytes += size
+	i := 0
+	for i < len(s.sizeBuckets) && size > s.sizeBuckets[i] {
+		i++
+	}
+	s.sizeCounts[i]++
+	i = 0
+	for i < len(s.latencyBuckets) && c.Ms > s.latencyBuckets[i] {
+		i++
+	}
+	s.latencyCounts[i]++
+}
+
+// 零值的 Stats 第一次使用时创建锁
+var statsLockMux sync.Mutex
+
+// lock 获取 Stats 的锁, 零值的 Stats 第一次使用时创建
+func (s *Stats) lock() *sync.Mutex {
+	statsLockMux.Lock()
+	defer statsLockMux.Unlock()
+	if s.mux == nil {
+		s.mux = &sync.Mutex{}
+	}
+	return s.mux
+}
+
+// init 零值的 Stats 第一次使用时初始化, 调用方需持有锁
+func (s *Stats) init() {
+	if s.Code == nil {
+		s.Code = make(map[int]int64)
+	}
+	if s.sizeCounts == nil {
+		s.sizeBuckets = append([]int64{}, DefaultSizeBuckets...)
+		s.sizeCounts = make([]int64, len(DefaultSizeBuckets)+1)
+		s.latencyBuckets = append([]time.Duration{}, DefaultLatencyBuckets...)
+		s.latencyCounts = make([]int64, len(DefaultLatencyBuckets)+1)
+	}
+}
+
+// addPage 统计一个完成的请求, 在请求(包括所有重试)结束后调用
+func (s *Stats) addPage(succeeded bool) {
+	s.lock().Lock()
+	defer s.mux.Unlock()
+	s.Pages++
+	if succeeded {
+		s.SuccessCount++
+	}
+}
+
+// Snapshot 获取当前统计的副本, 副本不再随请求更新
+func (s *Stats) Snapshot() Stats {
+	s.lock().Lock()
+	defer s.mux.Unlock()
+	code := make(map[int]int64, len(s.Code))
+	for k, v := range s.Code {
+		code[k] = v
+	}
+	return Stats{
+		Count:          s.Count,
+		ErrCount:       s.ErrCount,
+		Pages:          s.Pages,
+		SuccessCount:   s.SuccessCount,
+		Code:           code,
+		SumMs:          s.SumMs,
+		SumTTFB:        s.SumTTFB,
+		SumBytes:       s.SumBytes,
+		SumDNS:         s.SumDNS,
+		DNSCount:       s.DNSCount,
+		SumConnect:     s.SumConnect,
+		ConnectCount:   s.ConnectCount,
+		SumTLS:         s.SumTLS,
+		TLSCount:       s.TLSCount,
+		sizeBuckets:    append([]int64{}, s.sizeBuckets...),
+		sizeCounts:     append([]int64{}, s.sizeCounts...),
+		latencyBuckets: append([]time.Duration{}, s.latencyBuckets...),
+		latencyCounts:  append([]int64{}, s.latencyCounts...),
+		slowest:        append([]slowUrl{}, s.slowest...),
+		start:          s.start,
+		end:            s.end,
+	}
+}
+
+// AvgMs 平均响应时间
+func (s *Stats) AvgMs() time.Duration {
+	s.lock().Lock()
+	defer s.mux.Unlock()
+	if s.Count == 0 {
+		return 0
+	}
+	return s.SumMs / time.Duration(s.Count)
+}
+
+// AvgTTFB 平均首字节时间
+func (s *Stats) AvgTTFB() time.Duration {
+	s.lock().Lock()
+	defer s.mux.Unlock()
+	if s.Count == 0 {
+		return 0
+	}
+	return s.SumTTFB / time.Duration(s.Count)
+}
+
+// AvgDNS 平均DNS解析时间, 只计算进行了DNS解析的请求
+func (s *Stats) AvgDNS() time.Duration {
+	s.lock().Lock()
+	defer s.mux.Unlock()
+	return avgDuration(s.SumDNS, s.DNSCount)
+}
+
+// AvgConnect 平均建立连接时间, 只计算新建连接的请求
+func (s *Stats) AvgConnect() time.Duration {
+	s.lock().Lock()
+	defer s.mux.Unlock()
+	return avgDuration(s.SumConnect, s.ConnectCount)
+}
+
+// AvgTLS 平均TLS握手时间, 只计算进行了TLS握手的请求
+func (s *Stats) AvgTLS() time.Duration {
+	s.lock().Lock()
+	defer s.mux.Unlock()
+	return avgDuration(s.SumTLS, s.TLSCount)
+}
+
+func avgDuration(sum time.Duration, n int64) time.Duration {
+	if n == 0 {
+		return 0
+	}
+	return sum / time.Duration(n)
+}
+
+// addSlowest 记录最慢的请求, 调用方需持有锁
+func (s *Stats) addSlowest(c *Context) {
+	if len(s.slowest) >= statsSlowest && c.Ms <= s.slowest[len(s.slowest)-1].Ms {
+		return
+	}
+	u := ""
+	if c.Req != nil {
+		u = c.Req.URL.String()
+	}
+	i := sort.Search(len(s.slowest), func(i int) bool { return s.slowest[i].Ms < c.Ms })
+	s.slowest = append(s.slowest, slowUrl{})
+	copy(s.slowest[i+1:], s.slowest[i:])
+	s.slowest[i] = slowUrl{Url: u, Ms: c.Ms}
+	if len(s.slowest) > statsSlowest {
+		s.slowest = s.slowest[:statsSlowest]
+	}
+}
+
+// statsReport 抓取的汇总报告, 见 Stats.Report
+type statsReport struct {
+	Pages       int64 // 完成的请求数, 重试只计一次
+	Attempts    int64 // 请求次数, 包括重试
+	Success     int64
+	SuccessRate float64 // 0~1
+	Errors      int64   // 没有响应的次数
+	Code        map[int]int64
+	Bytes       int64
+	Duration    time.Duration // 第一个请求开始到最后一个请求结束的时间
+	AvgMs       time.Duration
+	Slowest     []slowUrl
+}
+
+// report 生成汇总报告
+func (s *Stats) report() statsReport {
+	s.lock().Lock()
+	defer s.mux.Unlock()
+	r := statsReport{
+		Pages:    s.Pages,
+		Attempts: s.Count,
+		Success:  s.SuccessCount,
+		Errors:   s.ErrCount,
+		Code:     make(map[int]int64, len(s.Code)),
+		Bytes:    s.SumBytes,
+		Duration: s.end.Sub(s.start),
+		Slowest:  append([]slowUrl{}, s.slowest...),
+	}
+	for k, v := range s.Code {
+		r.Code[k] = v
+	}
+	if s.Pages > 0 {
+		r.SuccessRate = float64(s.SuccessCount) / float64(s.Pages)
+	}
+	if s.Count > 0 {
+		r.AvgMs = s.SumMs / time.Duration(s.Count)
+	}
+	return r
+}
+
+// Report 生成多行文本的汇总报告, 包括请求数、成功率、状态码分布、总大小、用时与最慢的请求, 可以直接输出或发送邮件
+func (s *Stats) Report() string {
+	r := s.report()
+	var b strings.Builder
+	fmt.Fprintf(&b, "pages: %d\n", r.Pages)
+	fmt.Fprintf(&b, "attempts: %d\n", r.Attempts)
+	fmt.Fprintf(&b, "success: %d (%.2f%%)\n", r.Success, r.SuccessRate*100)
+	fmt.Fprintf(&b, "errors: %d\n", r.Errors)
+	b.WriteString("status:\n")
+	codes := make([]int, 0, len(r.Code))
+	for k := range r.Code {
+		codes = append(codes, k)
+	}
+	sort.Ints(codes)
+	for _, k := range codes {
+		fmt.Fprintf(&b, "  %d: %d\n", k, r.Code[k])
+	}
+	fmt.Fprintf(&b, "bytes: %s\n", FileSizeFormat(r.Bytes))
+	fmt.Fprintf(&b, "duration: %v\n", r.Duration)
+	fmt.Fprintf(&b, "avg time: %v\n", r.AvgMs)
+	b.WriteString("slowest:\n")
+	for _, v := range r.Slowest {
+		fmt.Fprintf(&b, "  %v %s\n", v.Ms, v.Url)
+	}
+	return b.String()
+}
+
+// ReportJSON 生成json格式的汇总报告, 内容与 Report 相同, 时间单位为毫秒
+func (s *Stats) ReportJSON() ([]byte, error) {
+	r := s.report()
+	type slow struct {
+		Url string `json:"url"`
+		Ms  int64  `json:"ms"`
+	}
+	slowest := make([]slow, len(r.Slowest))
+	for i, v := range r.Slowest {
+		slowest[i] = slow{Url: v.Url, Ms: int64(v.Ms / time.Millisecond)}
+	}
+	return json.Marshal(struct {
+		Pages       int64         `json:"pages"`
+		Attempts    int64         `json:"attempts"`
+		Success     int64         `json:"success"`
+		SuccessRate float64       `json:"success_rate"`
+		Errors      int64         `json:"errors"`
+		Code        map[int]int64 `json:"code"`
+		Bytes       int64         `json:"bytes"`
+		Duration    int64         `json:"duration_ms"`
+		AvgMs       int64         `json:"avg_ms"`
+		Slowest     []slow        `json:"slowest"`
+	}{
+		Pages:       r.Pages,
+		Attempts:    r.Attempts,
+		Success:     r.Success,
+		SuccessRate: r.SuccessRate,
+		Errors:      r.Errors,
+		Code:        r.Code,
+		Bytes:       r.Bytes,
+		Duration:    int64(r.Duration / time.Millisecond),
+		AvgMs:       int64(r.AvgMs / time.Millisecond),
+		Slowest:     slowest,
+	})
+}
+
+// Timing 请求各阶段的时间
+type Timing struct {
+	// DNS解析
+	DNS time.Duration
+
+	// 建立TCP连接
+	Connect time.Duration
+
+	// TLS握手
+	TLS time.Duration
+
+	// 首字节时间, 从发送请求到收到响应的第一个字节
+	TTFB time.Duration
+}
+
+// stat 统计本次请求
+func (c *Context) stat() {
+	if c.stats != nil {
+		c.stats.Add(c)
+	}
+}
+
+// trace 设置 httptrace 记录请求各阶段的时间
+func (c *Context) trace() {
+	if c.traced || c.Req == nil {
+		return
+	}
+	c.traced = true
+	c.reqCtx = c.Req.Context()
+	var dnsStart, connectStart, tlsStart time.Time
+	c.Req = c.Req.WithContext(httptrace.WithClientTrace(c.Req.Context(), &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			c.timingMux.Lock()
+			dnsStart = time.Now()
+			c.timingMux.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			c.timingMux.Lock()
+			c.Timing.DNS = time.Since(dnsStart)
+			c.timingMux.Unlock()
+		},
+		ConnectStart: func(network, addr string) {
+			c.timingMux.Lock()
+			if connectStart.Before(c.reqStart) {
+				connectStart = time.Now()
+			}
+			c.timingMux.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			c.timingMux.Lock()
+			if err == nil && c.Timing.Connect == 0 {
+				c.Timing.Connect = time.Since(connectStart)
+			}
+			c.timingMux.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			c.timingMux.Lock()
+			tlsStart = time.Now()
+			c.timingMux.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			c.timingMux.Lock()
+			c.Timing.TLS = time.Since(tlsStart)
+			c.timingMux.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			c.timingMux.Lock()
+			c.TTFB = time.Now().Sub(c.reqStart)
+			c.Timing.TTFB = c.TTFB
+			c.timingMux.Unlock()
+		},
+	}))
+}
@@ -0,0 +1,173 @@
+package gathertool
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTTFB(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprint(w, "body")
+	}))
+	defer ts.Close()
+
+	stats := NewStats()
+	c, err := Get(ts.URL, stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+
+	if c.TTFB <= 0 || c.TTFB >= c.Ms {
+		t.Fatalf("TTFB = %v, Ms = %v", c.TTFB, c.Ms)
+	}
+	if c.Ms < 50*time.Millisecond {
+		t.Fatalf("Ms = %v does not include the body", c.Ms)
+	}
+	if stats.Count != 1 || stats.Code[200] != 1 || stats.AvgTTFB() != c.TTFB || stats.AvgMs() != c.Ms {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestStatsHistogram(t *testing.T) {
+	stats := NewStats()
+	stats.SetBuckets([]int64{100, 1000}, []time.Duration{10 * time.Millisecond, 100 * time.Millisecond})
+
+	samples := []struct {
+		size int
+		ms   time.Duration
+	}{
+		{0, time.Millisecond},
+		{100, 10 * time.Millisecond},
+		{101, 11 * time.Millisecond},
+		{1000, 100 * time.Millisecond},
+		{5000, time.Second},
+		{50, 2 * time.Second},
+	}
+	for _, v := range samples {
+		stats.Add(&Context{RespBody: make([]byte, v.size), Ms: v.ms})
+	}
+
+	h := stats.Histogram()
+	if fmt.Sprint(h.SizeCounts) != "[3 2 1]" {
+		t.Fatalf("SizeCounts = %v", h.SizeCounts)
+	}
+	if fmt.Sprint(h.LatencyCounts) != "[2 2 2]" {
+		t.Fatalf("LatencyCounts = %v", h.LatencyCounts)
+	}
+	if stats.SumBytes != 6251 {
+		t.Fatalf("SumBytes = %d", stats.SumBytes)
+	}
+}
+
+func TestTiming(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	// 使用 localhost 才会进行DNS解析, 证书不包含 localhost 所以跳过校验
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	stats := NewStats()
+	c, err := Get(strings.Replace(ts.URL, "127.0.0.1", "localhost", 1), client, stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if c.Err != nil {
+		t.Fatal(c.Err)
+	}
+	if c.Timing.DNS <= 0 || c.Timing.Connect <= 0 || c.Timing.TLS <= 0 || c.Timing.TTFB <= 0 {
+		t.Fatalf("Timing = %+v", c.Timing)
+	}
+	if stats.AvgDNS() != c.Timing.DNS || stats.AvgConnect() != c.Timing.Connect || stats.AvgTLS() != c.Timing.TLS {
+		t.Fatalf("AvgDNS = %v, AvgConnect = %v, AvgTLS = %v, Timing = %+v", stats.AvgDNS(), stats.AvgConnect(), stats.AvgTLS(), c.Timing)
+	}
+
+	first := c.Timing
+	c.reset()
+	c.Do()
+	if stats.TLSCount != 2 || stats.AvgTLS() != (first.TLS+c.Timing.TLS)/2 {
+		t.Fatalf("TLSCount = %d, AvgTLS = %v", stats.TLSCount, stats.AvgTLS())
+	}
+}
+
+func TestStatsReport(t *testing.T) {
+	retried := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 重试一次后成功, 只计一个页面
+		if r.URL.Path == "/b" && !retried {
+			retried = true
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if r.URL.Path == "/404" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Path == "/slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		fmt.Fprint(w, "hello")
+	}))
+	defer ts.Close()
+
+	stats := NewStats()
+	for _, p := range []string{"/a", "/slow", "/404", "/b"} {
+		c, _ := Get(ts.URL+p, stats)
+		c.Do()
+	}
+
+	report := stats.Report()
+	for _, want := range []string{"pages: 4\n", "attempts: 5\n", "success: 3 (75.00%)\n", "errors: 0\n",
+		"  200: 3\n", "  404: 1\n", "  502: 1\n", "bytes: 15.00B\n", "duration: ", "slowest:\n"} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("report missing %q:\n%s", want, report)
+		}
+	}
+	slowest := report[strings.Index(report, "slowest:\n")+len("slowest:\n"):]
+	if !strings.Contains(strings.SplitN(slowest, "\n", 2)[0], ts.URL+"/slow") {
+		t.Fatalf("slowest:\n%s", slowest)
+	}
+
+	b, err := stats.ReportJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r struct {
+		Pages       int64            `json:"pages"`
+		SuccessRate float64          `json:"success_rate"`
+		Code        map[string]int64 `json:"code"`
+		Bytes       int64            `json:"bytes"`
+		Duration    int64            `json:"duration_ms"`
+		Slowest     []struct {
+			Url string `json:"url"`
+			Ms  int64  `json:"ms"`
+		} `json:"slowest"`
+	}
+	if err := json.Unmarshal(b, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Pages != 4 || r.SuccessRate != 0.75 || r.Code["404"] != 1 || r.Bytes != 15 || r.Duration < 50 ||
+		len(r.Slowest) != 5 || r.Slowest[0].Url != ts.URL+"/slow" || r.Slowest[0].Ms < 50 {
+		t.Fatalf("report json = %s", b)
+	}
+}
+
+func TestStatsZeroValue(t *testing.T) {
+	var stats Stats
+	stats.Add(&Context{RespBody: []byte("ab"), Ms: time.Millisecond})
+	stats.addPage(true)
+	if stats.Count != 1 || stats.SumBytes != 2 || !strings.Contains(stats.Report(), "success: 1 (100.00%)") {
+		t.Fatalf("report:\n%s", stats.Report())
+	}
+}
@@ -7,10 +7,14 @@
 
 package gathertool
 
+import "sync"
+
 // StatusCodeMap 状态码处理映射
 // success 该状态码对应执行成功函数
 // fail    该状态码对应执行失败函数
 // retry   该状态码对应需要重试前执行的函数
+// file    该状态码对应执行 FileFunc, 读取响应后交给使用方保存, 没有设置 FileFunc 则执行失败函数
+// 设置了 SetClassifier 时由分类方法决定事件, 不使用 StatusCodeMap
 var StatusCodeMap map[int]string = map[int]string{
 	200:"success",
 	201:"success",
@@ -46,7 +50,42 @@ func StatusCodeRetryEvent(code int){
 	StatusCodeMap[code] = "retry"
 }
 
-// 将指定状态码设置为执行重试事件
+// 将指定状态码设置为执行失败事件
 func StatusCodeFailEvent(code int){
 	StatusCodeMap[code] = "fail"
 }
+
+// 将指定状态码设置为执行 file 事件
+func StatusCodeFileEvent(code int){
+	StatusCodeMap[code] = "file"
+}
+
+// 响应对应的事件, 见 SetClassifier
+type Action string
+
+const (
+	ActionSuccess Action = "success" // 执行成功函数
+	ActionRetry   Action = "retry"   // 重试
+	ActionFail    Action = "fail"    // 执行失败函数
+	ActionFile    Action = "file"    // 执行 FileFunc
+)
+
+// 自定义的响应分类方法
+var (
+	classifier    func(c *Context) Action
+	classifierMux sync.RWMutex
+)
+
+// SetClassifier 设置自定义的响应分类方法, 设置后代替 StatusCodeMap 决定响应执行的事件, 可以根据响应头或响应内容判断
+// 执行分类方法前已读取响应body到 c.RespBody; OnStatus 注册的状态码优先; 传 nil 取消
+func SetClassifier(fn func(c *Context) Action) {
+	classifierMux.Lock()
+	defer classifierMux.Unlock()
+	classifier = fn
+}
+
+func getClassifier() func(c *Context) Action {
+	classifierMux.RLock()
+	defer classifierMux.RUnlock()
+	return classifier
+}
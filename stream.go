@@ -0,0 +1,67 @@
+package gathertool
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+// GetStream 流式 Get 请求, 响应到达时逐条回调 onEvent, 不等待连接关闭
+// text/event-stream(SSE) 按事件回调, 参数为事件的 data(多行 data 以 \n 连接); 其他类型按行回调
+// 流式请求不重试, 且不受 Client.Timeout 限制; vs 与 Get 相同
+func GetStream(url string, onEvent func([]byte), vs ...interface{}) (*Context, error) {
+	c, err := Get(url, vs...)
+	if err != nil {
+		return nil, err
+	}
+	client := *c.Client
+	client.Timeout = 0
+	c.Client = &client
+
+	c.prepare()
+	c.Resp, c.Err = c.Client.Do(c.Req)
+	if c.Err != nil {
+		return c, c.Err
+	}
+	defer c.Resp.Body.Close()
+
+	sse := strings.HasPrefix(c.Resp.Header.Get("Content-Type"), "text/event-stream")
+	c.Err = readStream(c.Resp.Body, sse, onEvent)
+	return c, c.Err
+}
+
+// readStream 读取流, sse 为 true 时按 SSE 事件解析
+func readStream(r io.Reader, sse bool, onEvent func([]byte)) error {
+	reader := bufio.NewReader(r)
+	var data [][]byte
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 || err == nil {
+			line = bytes.TrimRight(line, "\r\n")
+			switch {
+			case !sse:
+				if len(line) > 0 {
+					onEvent(line)
+				}
+			case len(line) == 0:
+				// 空行为一个事件的结束
+				if data != nil {
+					onEvent(bytes.Join(data, []byte("\n")))
+					data = nil
+				}
+			case bytes.HasPrefix(line, []byte("data:")):
+				data = append(data, bytes.TrimPrefix(bytes.TrimPrefix(line, []byte("data:")), []byte(" ")))
+			}
+		}
+		if err == io.EOF {
+			if sse && data != nil {
+				onEvent(bytes.Join(data, []byte("\n")))
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
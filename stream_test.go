@@ -0,0 +1,35 @@
+package gathertool
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetStream(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		fmt.Fprint(w, ": comment\n\nid: 1\ndata: one\n\n")
+		flusher.Flush()
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprint(w, "event: msg\ndata: two\ndata: lines\n\n")
+		flusher.Flush()
+		fmt.Fprint(w, "data: three\n\n")
+	}))
+	defer ts.Close()
+
+	events := make([]string, 0)
+	_, err := GetStream(ts.URL, func(b []byte) {
+		events = append(events, string(b))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"one", "two\nlines", "three"}
+	if fmt.Sprintf("%q", events) != fmt.Sprintf("%q", want) {
+		t.Fatalf("events = %q", events)
+	}
+}
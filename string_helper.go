@@ -5,10 +5,14 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"unicode"
 )
 
 //StringValue 任何类型返回值字符串形式
@@ -101,10 +105,39 @@ func MD5(str string) string  {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
-// json转map函数，通用
+// Json 解码到 interface{} 或 map 时数字是否解码为 json.Number, 默认是
+// json.Number 保留了大整数(如 int64 的id)的精度, 解码为 float64 会丢失精度
+var jsonUseNumber int32 = 1
+
+// SetJsonUseNumber 设置 JSON2Map、Context.Auto 等 Json 方法解码到 interface{} 或 map 时数字的类型
+// true 为 json.Number(默认), false 为 float64
+func SetJsonUseNumber(use bool) {
+	if use {
+		atomic.StoreInt32(&jsonUseNumber, 1)
+	} else {
+		atomic.StoreInt32(&jsonUseNumber, 0)
+	}
+}
+
+// jsonUnmarshal json解码, 按 SetJsonUseNumber 的设置解码数字
+func jsonUnmarshal(b []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	if atomic.LoadInt32(&jsonUseNumber) == 1 {
+		d.UseNumber()
+	}
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+// json转map函数，通用, 数字默认解码为 json.Number, 见 SetJsonUseNumber
 func JSON2Map(str string) map[string]interface{} {
 	var tempMap map[string]interface{}
-	err := json.Unmarshal([]byte(str), &tempMap)
+	err := jsonUnmarshal([]byte(str), &tempMap)
 	if err != nil {
 		panic(err)
 	}
@@ -121,13 +154,21 @@ func Any2String(data interface{}) string {
 	return StringValue(data)
 }
 
-// interface{} -> int
+// interface{} -> int, 支持 json.Number
 func Any2Int(data interface{}) int {
+	if n, ok := data.(json.Number); ok {
+		v, _ := n.Int64()
+		return int(v)
+	}
 	return data.(int)
 }
 
-// interface{} -> int64
+// interface{} -> int64, 支持 json.Number
 func Any2int64(data interface{}) int64 {
+	if n, ok := data.(json.Number); ok {
+		v, _ := n.Int64()
+		return v
+	}
 	return data.(int64)
 }
 
@@ -136,8 +177,12 @@ func Any2AnyList(data interface{}) []interface{} {
 	return data.([]interface{})
 }
 
-// interface{} -> float64
+// interface{} -> float64, 支持 json.Number
 func Any2Float64(data interface{}) float64 {
+	if n, ok := data.(json.Number); ok {
+		v, _ := n.Float64()
+		return v
+	}
 	return data.(float64)
 }
 
@@ -188,6 +233,56 @@ func StrDeleteSpace(str string) string {
 	return string(strList[:count-spaceCount])
 }
 
+// NormalizeText 的可选项
+type NormalizeOption int
+
+const (
+	StripZeroWidth NormalizeOption = iota + 1 // 删除零宽字符, 如 \u200b、\ufeff
+)
+
+// NormalizeText 规范化抓取的文本: 全角ASCII字符转半角, 全角空格与 nbsp 等空白合并为一个空格, 去除前后空白
+// 传入 StripZeroWidth 时删除零宽字符
+func NormalizeText(s string, opts ...NormalizeOption) string {
+	stripZeroWidth := false
+	for _, opt := range opts {
+		if opt == StripZeroWidth {
+			stripZeroWidth = true
+		}
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	space := false
+	for _, r := range s {
+		switch {
+		case r >= 0xFF01 && r <= 0xFF5E:
+			r -= 0xFEE0
+		case r == 0x3000:
+			r = ' '
+		case stripZeroWidth && isZeroWidth(r):
+			continue
+		}
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// isZeroWidth 是否是零宽字符
+func isZeroWidth(r rune) bool {
+	switch r {
+	case 0x200B, 0x200C, 0x200D, 0x2060, 0xFEFF:
+		return true
+	}
+	return false
+}
+
 // string -> int64
 func Str2Int64(str string) int64 {
 	i, err := strconv.ParseInt(str, 10, 64)
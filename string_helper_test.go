@@ -0,0 +1,42 @@
+package gathertool
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSON2MapUseNumber(t *testing.T) {
+	m := JSON2Map(`{"id": 1234567890123456789, "price": 9.9}`)
+	id, ok := m["id"].(json.Number)
+	if !ok || id.String() != "1234567890123456789" {
+		t.Fatalf("id = %#v", m["id"])
+	}
+	if Any2int64(m["id"]) != 1234567890123456789 || Any2Float64(m["price"]) != 9.9 {
+		t.Fatalf("m = %v", m)
+	}
+
+	SetJsonUseNumber(false)
+	defer SetJsonUseNumber(true)
+	if _, ok := JSON2Map(`{"id": 1}`)["id"].(float64); !ok {
+		t.Fatal("id is not float64")
+	}
+}
+
+func TestNormalizeText(t *testing.T) {
+	cases := []struct {
+		in   string
+		opts []NormalizeOption
+		want string
+	}{
+		{"\uff11\uff12\uff13\uff0e\uff15\u5143", nil, "123.5\u5143"},
+		{"  \uff21\uff22\uff23\u00a0\u00a0abc\t\n", nil, "ABC abc"},
+		{"a\u3000b", nil, "a b"},
+		{"a\u200bb\ufeff", nil, "a\u200bb\ufeff"},
+		{"a\u200bb\ufeff", []NormalizeOption{StripZeroWidth}, "ab"},
+	}
+	for _, c := range cases {
+		if got := NormalizeText(c.in, c.opts...); got != c.want {
+			t.Errorf("NormalizeText(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+/*
+	Description : 响应内容落盘
+	Author : ManGe
+	Version : v0.1
+	Date : 2021-04-29
+*/
+
+package gathertool
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TeeDir 响应内容落盘目录
+// 每个响应的 body 在读取时同步写入该目录, 文件名为 url的md5_时间戳
+// 同名的 .header 文件记录状态码与响应头
+type TeeDir string
+
+// 落盘的 body 是否gzip压缩
+type TeeGzip bool
+
+// CompressTee 落盘的 body 使用gzip压缩保存, 文件名加 .gz 后缀, 使用 ReadTee 读取
+func CompressTee() TeeGzip {
+	return true
+}
+
+// ReadTee 读取落盘的 body, .gz 后缀的文件自动解压
+func ReadTee(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if !strings.HasSuffix(path, ".gz") {
+		return ioutil.ReadAll(f)
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return ioutil.ReadAll(gz)
+}
+
+// readBody 读取响应 body, 设置了 TeeDir 则边读边落盘
+// 落盘出错只输出日志, 不影响 body 的读取
+func (c *Context) readBody() ([]byte, error) {
+	if c.teeDir == "" {
+		return ioutil.ReadAll(c.Resp.Body)
+	}
+
+	dir := string(c.teeDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		c.logln("[Tee] Error : ", err)
+		return ioutil.ReadAll(c.Resp.Body)
+	}
+	name := filepath.Join(dir, fmt.Sprintf("%s_%d", MD5(c.Req.URL.String()), time.Now().UnixNano()))
+
+	bodyName := name
+	if c.teeGzip {
+		bodyName += ".gz"
+	}
+	f, err := os.Create(bodyName)
+	if err != nil {
+		c.logln("[Tee] Error : ", err)
+		return ioutil.ReadAll(c.Resp.Body)
+	}
+	defer f.Close()
+
+	w := &teeWriter{w: f}
+	var gz *gzip.Writer
+	if c.teeGzip {
+		gz = gzip.NewWriter(f)
+		w.w = gz
+	}
+	body, err := ioutil.ReadAll(io.TeeReader(c.Resp.Body, w))
+	if err != nil {
+		return body, err
+	}
+	if gz != nil && w.err == nil {
+		w.err = gz.Close()
+	}
+	if w.err != nil {
+		c.logln("[Tee] Error : ", w.err)
+		return body, nil
+	}
+
+	h, err := os.Create(name + ".header")
+	if err != nil {
+		c.logln("[Tee] Error : ", err)
+		return body, nil
+	}
+	defer h.Close()
+	_, _ = fmt.Fprintf(h, "%s %s\r\n", c.Resp.Proto, c.Resp.Status)
+	_ = c.Resp.Header.Write(h)
+
+	return body, nil
+}
+
+// teeWriter 落盘的 Writer, 写入出错后不再写入并记录错误, 不返回给 TeeReader
+type teeWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	if t.err == nil {
+		_, t.err = t.w.Write(p)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,130 @@
+package gathertool
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTeeDir(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "tee")
+		fmt.Fprint(w, "hello tee")
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "tee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := Get(ts.URL, TeeDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if string(c.RespBody) != "hello tee" {
+		t.Fatalf("RespBody = %q", c.RespBody)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 2 {
+		t.Fatalf("files = %v", files)
+	}
+	for _, f := range files {
+		b, _ := ioutil.ReadFile(f)
+		if strings.HasSuffix(f, ".header") {
+			if !strings.Contains(string(b), "200 OK") || !strings.Contains(string(b), "X-Test: tee") {
+				t.Fatalf("header file = %q", b)
+			}
+			continue
+		}
+		if string(b) != string(c.RespBody) {
+			t.Fatalf("tee file = %q, body = %q", b, c.RespBody)
+		}
+	}
+}
+
+func TestTeeGzip(t *testing.T) {
+	body := strings.Repeat("<tr><td>1.0.1.0</td><td>1.0.3.255</td></tr>\n", 200)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "tee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := Get(ts.URL, TeeDir(dir), CompressTee())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if string(c.RespBody) != body {
+		t.Fatal("RespBody changed")
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.gz"))
+	if len(files) != 1 {
+		t.Fatalf("files = %v", files)
+	}
+	info, _ := os.Stat(files[0])
+	if info.Size() >= int64(len(body)) {
+		t.Fatalf("gz size = %d, body size = %d", info.Size(), len(body))
+	}
+	b, err := ReadTee(files[0])
+	if err != nil || string(b) != body {
+		t.Fatalf("ReadTee = %d bytes, err = %v", len(b), err)
+	}
+	if _, err := os.Stat(strings.TrimSuffix(files[0], ".gz") + ".header"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTeeDirError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello tee")
+	}))
+	defer ts.Close()
+
+	// TeeDir 的上级是文件, 不能创建目录
+	f, err := ioutil.TempFile("", "tee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	c, err := Get(ts.URL, TeeDir(filepath.Join(f.Name(), "sub")), CompressTee())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Do()
+	if c.Err != nil || string(c.RespBody) != "hello tee" {
+		t.Fatalf("RespBody = %q, err = %v", c.RespBody, c.Err)
+	}
+
+	// 写入出错不影响读取
+	w := &teeWriter{w: failWriter{}}
+	body, err := ioutil.ReadAll(io.TeeReader(strings.NewReader("hello tee"), w))
+	if err != nil || string(body) != "hello tee" || w.err == nil {
+		t.Fatalf("body = %q, err = %v, tee err = %v", body, err, w.err)
+	}
+}
+
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("no space left on device")
+}
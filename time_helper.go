@@ -1,6 +1,12 @@
 package gathertool
 
-import "time"
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // BeginDayUnix 获取当天 0点
 func BeginDayUnix() int64 {
@@ -22,4 +28,135 @@ func EndDayUnix() int64 {
 
 // 获取多少天前的时间戳
 
+// 当前时间, 测试时替换
+var timeNow = time.Now
 
+// ParseDate 的内置格式, 按顺序尝试
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-1-2 15:04:05",
+	"2006-1-2 15:04",
+	"2006-1-2T15:04:05",
+	"2006-1-2",
+	"2006/1/2 15:04:05",
+	"2006/1/2 15:04",
+	"2006/1/2",
+	"2006.1.2",
+	"20060102",
+	"2006年1月2日 15:04:05",
+	"2006年1月2日 15:04",
+	"2006年1月2日15:04",
+	"2006年1月2日",
+	"2006年1月",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC850,
+	"Jan 2, 2006",
+	"2 Jan 2006",
+	"January 2, 2006",
+}
+
+// 没有年份的格式, 年份为今年
+var monthDayLayouts = []string{
+	"1月2日 15:04",
+	"1月2日",
+	"01-02 15:04",
+	"1-2",
+}
+
+var (
+	relativeDateReg = regexp.MustCompile(`^(\d+)\s*(秒|秒钟|分|分钟|小时|个小时|天|日|周|星期|个月|月|年)前$`)
+	relativeDateEnReg = regexp.MustCompile(`^(\d+)\s*(second|minute|min|hour|day|week|month|year)s?\s+ago$`)
+	dayTimeReg = regexp.MustCompile(`^(今天|昨天|前天|today|yesterday)\s*(\d{1,2}:\d{2}(:\d{2})?)?$`)
+)
+
+// ParseDate 解析抓取到的日期字符串, 返回本地时区的时间
+// 先按传入的 layouts 解析, 再尝试内置的常见格式: ISO(2021-04-25、RFC3339)、中文(2021年4月25日 15:04)、
+// 没有年份的(4月25日, 为今年)、相对时间(刚刚、3天前、昨天 15:04、2 days ago)与10位或13位的时间戳
+func ParseDate(s string, layouts ...string) (time.Time, error) {
+	s = NormalizeText(s, StripZeroWidth)
+	if s == "" {
+		return time.Time{}, errors.New("date is null.")
+	}
+	for _, list := range [][]string{layouts, dateLayouts} {
+		for _, layout := range list {
+			if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				return t, nil
+			}
+		}
+	}
+	now := timeNow()
+	for _, layout := range monthDayLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t.AddDate(now.Year(), 0, 0), nil
+		}
+	}
+	if t, ok := parseRelativeDate(strings.ToLower(s), now); ok {
+		return t, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch len(s) {
+		case 10:
+			return time.Unix(n, 0), nil
+		case 13:
+			return time.Unix(0, n*int64(time.Millisecond)), nil
+		}
+	}
+	return time.Time{}, errors.New("unknown date format : " + s)
+}
+
+// parseRelativeDate 解析相对时间, 如 "刚刚"、"3天前"、"昨天 15:04"、"2 days ago"
+func parseRelativeDate(s string, now time.Time) (time.Time, bool) {
+	switch s {
+	case "刚刚", "just now", "now":
+		return now, true
+	}
+	unit, n := "", 0
+	if m := relativeDateReg.FindStringSubmatch(s); m != nil {
+		n, _ = strconv.Atoi(m[1])
+		unit = m[2]
+	} else if m := relativeDateEnReg.FindStringSubmatch(s); m != nil {
+		n, _ = strconv.Atoi(m[1])
+		unit = m[2]
+	}
+	switch unit {
+	case "秒", "秒钟", "second":
+		return now.Add(-time.Duration(n) * time.Second), true
+	case "分", "分钟", "minute", "min":
+		return now.Add(-time.Duration(n) * time.Minute), true
+	case "小时", "个小时", "hour":
+		return now.Add(-time.Duration(n) * time.Hour), true
+	case "天", "日", "day":
+		return now.AddDate(0, 0, -n), true
+	case "周", "星期", "week":
+		return now.AddDate(0, 0, -7*n), true
+	case "个月", "月", "month":
+		return now.AddDate(0, -n, 0), true
+	case "年", "year":
+		return now.AddDate(-n, 0, 0), true
+	}
+
+	m := dayTimeReg.FindStringSubmatch(s)
+	if m == nil {
+		return time.Time{}, false
+	}
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch m[1] {
+	case "昨天", "yesterday":
+		day = day.AddDate(0, 0, -1)
+	case "前天":
+		day = day.AddDate(0, 0, -2)
+	}
+	if m[2] != "" {
+		layout := "15:04"
+		if m[3] != "" {
+			layout = "15:04:05"
+		}
+		t, err := time.Parse(layout, m[2])
+		if err != nil {
+			return time.Time{}, false
+		}
+		day = day.Add(time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second)
+	}
+	return day, true
+}
@@ -0,0 +1,44 @@
+package gathertool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2021, 4, 27, 10, 30, 0, 0, time.Local)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	cases := []struct {
+		in      string
+		layouts []string
+		want    time.Time
+	}{
+		{"2021-04-25", nil, time.Date(2021, 4, 25, 0, 0, 0, 0, time.Local)},
+		{"2021-4-25 08:05:09", nil, time.Date(2021, 4, 25, 8, 5, 9, 0, time.Local)},
+		{"2021-04-25T08:05:09+08:00", nil, time.Date(2021, 4, 25, 0, 5, 9, 0, time.UTC)},
+		{"2021/04/25", nil, time.Date(2021, 4, 25, 0, 0, 0, 0, time.Local)},
+		{"2021年4月25日", nil, time.Date(2021, 4, 25, 0, 0, 0, 0, time.Local)},
+		{" 2021年04月25日 15:04 ", nil, time.Date(2021, 4, 25, 15, 4, 0, 0, time.Local)},
+		{"２０２１年４月２５日", nil, time.Date(2021, 4, 25, 0, 0, 0, 0, time.Local)},
+		{"4月25日", nil, time.Date(2021, 4, 25, 0, 0, 0, 0, time.Local)},
+		{"25/04/2021", []string{"02/01/2006"}, time.Date(2021, 4, 25, 0, 0, 0, 0, time.Local)},
+		{"刚刚", nil, now},
+		{"5分钟前", nil, now.Add(-5 * time.Minute)},
+		{"3天前", nil, time.Date(2021, 4, 24, 10, 30, 0, 0, time.Local)},
+		{"2 days ago", nil, time.Date(2021, 4, 25, 10, 30, 0, 0, time.Local)},
+		{"昨天 15:04", nil, time.Date(2021, 4, 26, 15, 4, 0, 0, time.Local)},
+		{"前天", nil, time.Date(2021, 4, 25, 0, 0, 0, 0, time.Local)},
+		{"1619321234", nil, time.Unix(1619321234, 0)},
+	}
+	for _, c := range cases {
+		got, err := ParseDate(c.in, c.layouts...)
+		if err != nil || !got.Equal(c.want) {
+			t.Errorf("ParseDate(%q) = %v, %v, want %v", c.in, got, err, c.want)
+		}
+	}
+	if _, err := ParseDate("not a date"); err == nil {
+		t.Fatal("expected error")
+	}
+}
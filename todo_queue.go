@@ -8,9 +8,17 @@
 package gathertool
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net/url"
+	"os"
+	"strings"
 	"sync"
 )
 
@@ -23,10 +31,49 @@ type TodoQueue interface {
 	Print() // 打印
 }
 
+var TaskRepeat error = errors.New("task is repeat.") // 重复的任务
+
 // 队列
 type Queue struct {
 	mux *sync.Mutex
 	list []*Task
+
+	// 去重, 默认不去重, 见 SetDedup
+	taskDedup
+}
+
+// taskDedup 队列的去重, key 为nil时不去重, 调用方需持有队列的锁
+type taskDedup struct {
+	key func(task *Task) string
+	seen map[string]struct{}
+	bloom *bloomFilter
+}
+
+// setKey 设置去重的key, keyFunc 为nil时使用 CanonicalURL(task.Url)
+func (d *taskDedup) setKey(keyFunc func(task *Task) string) {
+	if keyFunc == nil {
+		keyFunc = func(task *Task) string { return CanonicalURL(task.Url) }
+	}
+	d.key = keyFunc
+	if d.seen == nil && d.bloom == nil {
+		d.seen = make(map[string]struct{})
+	}
+}
+
+// repeat 任务是否重复, 不重复则记录; 重新入队的任务(Retry > 0)不参与去重
+func (d *taskDedup) repeat(task *Task) bool {
+	if d.key == nil || task.Retry > 0 {
+		return false
+	}
+	key := d.key(task)
+	if d.bloom != nil {
+		return d.bloom.TestAndAdd(key)
+	}
+	if _, ok := d.seen[key]; ok {
+		return true
+	}
+	d.seen[key] = struct{}{}
+	return false
 }
 
 // 任务对象
@@ -39,6 +86,33 @@ type Task struct {
 	SavePath string
 	SaveDir string
 	FileName string
+	Retry int // 重新入队的次数
+
+	// 传递给处理方法的临时对象, 如共享的 *Csv、*Mysql
+	// 与 Data 不同, Meta 不会被 Queue.Save 保存
+	Meta map[string]interface{} `json:"-"`
+}
+
+// Clone 复制任务, Data 与 Urls 为新的副本
+func (t *Task) Clone() *Task {
+	task := *t
+	if t.Data != nil {
+		task.Data = make(map[string]interface{}, len(t.Data))
+		for k, v := range t.Data {
+			task.Data[k] = v
+		}
+	}
+	if t.Meta != nil {
+		task.Meta = make(map[string]interface{}, len(t.Meta))
+		for k, v := range t.Meta {
+			task.Meta[k] = v
+		}
+	}
+	if t.Urls != nil {
+		task.Urls = make([]*ReqUrl, len(t.Urls))
+		copy(task.Urls, t.Urls)
+	}
+	return &task
 }
 
 // 单个请求地址对象
@@ -48,16 +122,86 @@ type ReqUrl struct {
 	Params  map[string]interface{}
 }
 
-// NewQueue 新建一个队列
+// NewQueue 新建一个队列, 默认不去重, 失败的任务可以重新 Add; 需要去重时调用 SetDedup 或使用 NewDedupQueue
 func NewQueue() TodoQueue {
 	list := make([]*Task, 0)
 	return &Queue{list: list, mux: &sync.Mutex{}}
 }
 
+// NewDedupQueue 新建一个去重的队列, keyFunc 为nil时使用 CanonicalURL(task.Url) 作为去重的key
+func NewDedupQueue(keyFunc func(task *Task) string) TodoQueue {
+	q := &Queue{list: make([]*Task, 0), mux: &sync.Mutex{}}
+	q.SetDedup(keyFunc)
+	return q
+}
+
+// SetDedup 开启去重, 重复的任务 Add 时返回 TaskRepeat
+// keyFunc 为nil时使用 CanonicalURL(task.Url) 作为去重的key
+// 通过 Context.Requeue 重新入队的任务(Retry > 0)不参与去重
+func (q *Queue) SetDedup(keyFunc func(task *Task) string) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	q.setKey(keyFunc)
+}
+
+// SetDedupBloom 使用布隆过滤器去重, 适用于超大量的任务, 内存大小固定
+// expectedItems 为预计的任务数, falsePositiveRate 为误判率
+// 注意: 有 falsePositiveRate 的概率把没有添加过的任务误判为重复而丢弃,
+// 任务数超过 expectedItems 后误判率会升高
+func (q *Queue) SetDedupBloom(expectedItems int, falsePositiveRate float64) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	if q.key == nil {
+		q.setKey(nil)
+	}
+	q.bloom = newBloomFilter(expectedItems, falsePositiveRate)
+	q.seen = nil
+}
+
 // Add 向队列中添加元素
 func (q *Queue) Add(task *Task) error {
 	q.mux.Lock()
 	defer q.mux.Unlock()
+	return q.add(task)
+}
+
+// AddBatch 批量添加任务, 只加一次锁, 按顺序添加, 返回加入队列的任务数(重复的任务不计)
+// 在回调中一次发现大量链接时推荐使用, 避免循环 Add 时的锁竞争
+func (q *Queue) AddBatch(tasks []*Task) int {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	n := 0
+	for _, task := range tasks {
+		if q.add(task) == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// AddWithParams 添加url任务, url的查询参数解码后保存到 Task.Data
+// 只出现一次的参数为 string, 出现多次的参数为 []string
+func (q *Queue) AddWithParams(rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return err
+	}
+	task := &Task{Url: rawUrl, Data: make(map[string]interface{})}
+	for k, v := range u.Query() {
+		if len(v) == 1 {
+			task.Data[k] = v[0]
+		} else {
+			task.Data[k] = v
+		}
+	}
+	return q.Add(task)
+}
+
+// add 添加任务, 调用方需持有锁
+func (q *Queue) add(task *Task) error {
+	if q.repeat(task) {
+		return TaskRepeat
+	}
 	q.list = append(q.list,task)
 	return nil
 }
@@ -92,6 +236,13 @@ func (q *Queue) Size() int {
 	return len(q.list)
 }
 
+// Len 获取队列的元素个数, 并发安全
+func (q *Queue) Len() int {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return len(q.list)
+}
+
 func (q *Queue) IsEmpty() bool {
 	if len(q.list) == 0 {
 		return true
@@ -103,11 +254,189 @@ func (q *Queue) Print() {
 	log.Println(q.list)
 }
 
+// Save 将队列中的任务保存为json文件, 用于中断后恢复, Task.Meta 不保存
+func (q *Queue) Save(path string) error {
+	q.mux.Lock()
+	b, err := json.Marshal(q.list)
+	q.mux.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// Load 加载 Save 保存的任务到队列, 返回加入队列的任务数
+func (q *Queue) Load(path string) (int, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	list := make([]*Task, 0)
+	if err := json.Unmarshal(b, &list); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, task := range list {
+		if err := q.Add(task); err == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// LoadFromFile 从文件加载任务, 每行一个url, 空行与 # 开头的行忽略
+// .gz 文件或内容为 gzip 格式时自动解压; 返回加入队列的任务数
+func (q *Queue) LoadFromFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	// gzip 的 magic number 为 1f 8b
+	magic, _ := reader.Peek(2)
+	if strings.HasSuffix(path, ".gz") || bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return 0, err
+		}
+		defer gz.Close()
+		reader = bufio.NewReader(gz)
+	}
+
+	n := 0
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := q.Add(&Task{Url: line}); err == nil {
+			n++
+		}
+	}
+	return n, scanner.Err()
+}
+
+
+// RoundRobinQueue 多个命名的子队列, Poll 轮流从每个子队列取任务
+// 用于多个入口(如多个分类)公平地交替抓取, 而不是抓完一个再抓下一个
+type RoundRobinQueue struct {
+	mux   *sync.Mutex
+	names []string // 子队列按创建的顺序轮流
+	lists map[string][]*Task
+	next  int
+
+	// 去重, 所有子队列共用, 见 SetDedup
+	taskDedup
+}
+
+// NewRoundRobinQueue 新建多个子队列轮流出队的队列
+func NewRoundRobinQueue() *RoundRobinQueue {
+	return &RoundRobinQueue{mux: &sync.Mutex{}, lists: make(map[string][]*Task)}
+}
+
+// Add 添加到默认的子队列(名称为 "")
+func (q *RoundRobinQueue) Add(task *Task) error {
+	return q.AddTo("", task)
+}
+
+// AddTo 添加到指定名称的子队列, 子队列不存在时新建
+func (q *RoundRobinQueue) AddTo(name string, task *Task) error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	if q.repeat(task) {
+		return TaskRepeat
+	}
+	if _, ok := q.lists[name]; !ok {
+		q.names = append(q.names, name)
+	}
+	q.lists[name] = append(q.lists[name], task)
+	return nil
+}
+
+// SetDedup 开启去重, 所有子队列共用, 重复的任务 Add 时返回 TaskRepeat, 见 Queue.SetDedup
+func (q *RoundRobinQueue) SetDedup(keyFunc func(task *Task) string) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	q.setKey(keyFunc)
+}
+
+// Poll 从下一个不为空的子队列取出最前面的任务
+func (q *RoundRobinQueue) Poll() *Task {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	for i := 0; i < len(q.names); i++ {
+		name := q.names[(q.next+i)%len(q.names)]
+		list := q.lists[name]
+		if len(list) == 0 {
+			continue
+		}
+		q.next = (q.next + i + 1) % len(q.names)
+		q.lists[name] = list[1:]
+		return list[0]
+	}
+	fmt.Println("queue is empty!")
+	return nil
+}
+
+func (q *RoundRobinQueue) Clear() bool {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	if q.size() == 0 {
+		fmt.Println("queue is empty!")
+		return false
+	}
+	q.names = nil
+	q.lists = make(map[string][]*Task)
+	q.next = 0
+	return true
+}
+
+func (q *RoundRobinQueue) Size() int {
+	return q.Len()
+}
+
+// Len 获取所有子队列的元素个数, 并发安全
+func (q *RoundRobinQueue) Len() int {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return q.size()
+}
+
+// SizeOf 获取子队列的元素个数
+func (q *RoundRobinQueue) SizeOf(name string) int {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return len(q.lists[name])
+}
+
+func (q *RoundRobinQueue) size() int {
+	n := 0
+	for _, list := range q.lists {
+		n += len(list)
+	}
+	return n
+}
+
+func (q *RoundRobinQueue) IsEmpty() bool {
+	return q.Len() == 0
+}
+
+func (q *RoundRobinQueue) Print() {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	log.Println(q.lists)
+}
 
 // 下载队列
 type UploadQueue struct {
 	mux *sync.Mutex
 	list []*Task
+
+	// 去重, 见 SetDedup
+	taskDedup
 }
 
 // NewQueue 新建一个队列
@@ -126,10 +455,20 @@ func (q *UploadQueue) Add(task *Task) error {
 	}
 	q.mux.Lock()
 	defer q.mux.Unlock()
+	if q.repeat(task) {
+		return TaskRepeat
+	}
 	q.list = append(q.list,task)
 	return nil
 }
 
+// SetDedup 开启去重, 重复的任务 Add 时返回 TaskRepeat, 见 Queue.SetDedup
+func (q *UploadQueue) SetDedup(keyFunc func(task *Task) string) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	q.setKey(keyFunc)
+}
+
 // Poll 移除队列中最前面的额元素
 func (q *UploadQueue) Poll() *Task {
 	q.mux.Lock()
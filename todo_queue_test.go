@@ -0,0 +1,247 @@
+package gathertool
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDedupQueue(t *testing.T) {
+	queue := NewDedupQueue(nil)
+	urls := []string{
+		"http://host/a",
+		"http://host/a/",
+		"HTTP://HOST:80/a#top",
+		"http://host/a?c=2&b=1",
+		"http://host/a?b=1&c=2",
+	}
+	for _, u := range urls {
+		_ = queue.Add(&Task{Url: u})
+	}
+	if queue.Size() != 2 {
+		t.Fatalf("Size = %d", queue.Size())
+	}
+	if err := queue.Add(&Task{Url: "http://host/a/"}); err != TaskRepeat {
+		t.Fatalf("err = %v", err)
+	}
+	if err := queue.Add(&Task{Url: "http://host/a", Retry: 1}); err != nil {
+		t.Fatalf("requeue err = %v", err)
+	}
+}
+
+func TestTodoQueueSetDedup(t *testing.T) {
+	queues := []TodoQueue{NewQueue(), NewRoundRobinQueue(), NewUploadQueue()}
+	for _, q := range queues {
+		a := &Task{Url: "http://Host/a?b=1&c=2", SavePath: "a"}
+		b := &Task{Url: "http://host/a?c=2&b=1#top", SavePath: "b"}
+		// 默认不去重
+		if q.Add(a) != nil || q.Add(a) != nil {
+			t.Fatalf("%T dedups by default", q)
+		}
+		q.(interface{ SetDedup(func(*Task) string) }).SetDedup(nil)
+		if err := q.Add(a); err != nil {
+			t.Fatalf("%T: %v", q, err)
+		}
+		if err := q.Add(b); err != TaskRepeat {
+			t.Fatalf("%T: err = %v", q, err)
+		}
+		if err := q.Add(&Task{Url: b.Url, SavePath: "b", Retry: 1}); err != nil {
+			t.Fatalf("%T requeue: %v", q, err)
+		}
+		if q.Size() != 4 {
+			t.Fatalf("%T size = %d", q, q.Size())
+		}
+	}
+}
+
+func TestDedupBloom(t *testing.T) {
+	const n = 10000
+	queue := NewQueue().(*Queue)
+	queue.SetDedupBloom(n, 0.01)
+	size := len(queue.bloom.bits)
+
+	for i := 0; i < n; i++ {
+		_ = queue.Add(&Task{Url: fmt.Sprintf("http://host/page/%d", i)})
+	}
+	// 误判丢弃的任务在误判率范围内
+	if dropped := n - queue.Size(); dropped > n*3/100 {
+		t.Fatalf("dropped %d of %d", dropped, n)
+	}
+	for i := 0; i < n; i++ {
+		if err := queue.Add(&Task{Url: fmt.Sprintf("http://host/page/%d/", i)}); err != TaskRepeat {
+			t.Fatalf("task %d was not deduplicated", i)
+		}
+	}
+	if len(queue.bloom.bits) != size || queue.seen != nil {
+		t.Fatal("bloom filter memory is not bounded")
+	}
+	// 约 9.6 bit 每个元素
+	if size*64 > n*12 {
+		t.Fatalf("bloom filter bits = %d", size*64)
+	}
+}
+
+func TestLoadFromFileGzip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write([]byte("# seed\nhttp://host/1\n\nhttp://host/2\r\nhttp://host/3"))
+	_ = gz.Close()
+
+	for _, name := range []string{"seed.txt.gz", "seed.txt"} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		queue := NewQueue().(*Queue)
+		n, err := queue.LoadFromFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 3 || queue.Poll().Url != "http://host/1" || queue.Poll().Url != "http://host/2" {
+			t.Fatalf("%s: n = %d", name, n)
+		}
+	}
+}
+
+func TestTaskMeta(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "save")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queue.json")
+
+	var out bytes.Buffer
+	queue := NewQueue().(*Queue)
+	_ = queue.Add(&Task{
+		Url:  ts.URL,
+		Data: map[string]interface{}{"page": "1"},
+		Meta: map[string]interface{}{"out": &out},
+	})
+	if err := queue.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadFile(path)
+	if bytes.Contains(b, []byte("Meta")) || bytes.Contains(b, []byte("out")) {
+		t.Fatalf("Meta was saved: %s", b)
+	}
+
+	StartJobGet(1, queue, SucceedFunc(func(c *Context) {
+		c.Task.Meta["out"].(*bytes.Buffer).Write(c.RespBody)
+	}))
+	if out.String() != "ok" {
+		t.Fatalf("out = %q", out.String())
+	}
+
+	n, err := queue.Load(path)
+	if err != nil || n != 1 {
+		t.Fatalf("n = %d, err = %v", n, err)
+	}
+	task := queue.Poll()
+	if task.Data["page"] != "1" || task.Meta != nil {
+		t.Fatalf("task = %+v", task)
+	}
+}
+
+func TestAddBatch(t *testing.T) {
+	q := NewDedupQueue(nil).(*Queue)
+	tasks := make([]*Task, 0, 101)
+	for i := 0; i < 100; i++ {
+		tasks = append(tasks, &Task{Url: fmt.Sprintf("http://example.com/%d", i)})
+	}
+	tasks = append(tasks, &Task{Url: "http://example.com/0"})
+	if n := q.AddBatch(tasks); n != 100 {
+		t.Fatalf("added = %d", n)
+	}
+	for i := 0; i < 100; i++ {
+		if task := q.Poll(); task.Url != fmt.Sprintf("http://example.com/%d", i) {
+			t.Fatalf("task %d = %s", i, task.Url)
+		}
+	}
+}
+
+func benchmarkTasks() []*Task {
+	tasks := make([]*Task, 500)
+	for i := range tasks {
+		tasks[i] = &Task{Url: fmt.Sprintf("http://example.com/%d", i)}
+	}
+	return tasks
+}
+
+func BenchmarkQueueAdd(b *testing.B) {
+	tasks := benchmarkTasks()
+	for i := 0; i < b.N; i++ {
+		q := NewQueue()
+		for _, task := range tasks {
+			_ = q.Add(task)
+		}
+	}
+}
+
+func BenchmarkQueueAddBatch(b *testing.B) {
+	tasks := benchmarkTasks()
+	for i := 0; i < b.N; i++ {
+		q := NewQueue().(*Queue)
+		q.AddBatch(tasks)
+	}
+}
+
+func TestAddWithParams(t *testing.T) {
+	q := NewQueue().(*Queue)
+	if err := q.AddWithParams("http://example.com/list?cat=%E4%B9%A6&id=42&tag=a&tag=b"); err != nil {
+		t.Fatal(err)
+	}
+	task := q.Poll()
+	if task.Data["cat"] != "书" || task.Data["id"] != "42" {
+		t.Fatalf("data = %v", task.Data)
+	}
+	if tags, ok := task.Data["tag"].([]string); !ok || len(tags) != 2 || tags[1] != "b" {
+		t.Fatalf("tag = %v", task.Data["tag"])
+	}
+	if err := q.AddWithParams("http://example.com/%zz"); err == nil {
+		t.Fatal("expected error for bad url")
+	}
+}
+
+func TestRoundRobinQueue(t *testing.T) {
+	q := NewRoundRobinQueue()
+	for i := 0; i < 3; i++ {
+		_ = q.AddTo("book", &Task{Url: fmt.Sprintf("book%d", i)})
+	}
+	_ = q.AddTo("music", &Task{Url: "music0"})
+	for i := 0; i < 2; i++ {
+		_ = q.AddTo("movie", &Task{Url: fmt.Sprintf("movie%d", i)})
+	}
+	// 出队过程中添加的任务也参与轮流
+	_ = q.AddTo("music", &Task{Url: "music1"})
+
+	want := []string{"book0", "music0", "movie0", "book1", "music1", "movie1", "book2"}
+	if q.Len() != len(want) || q.SizeOf("book") != 3 {
+		t.Fatalf("len = %d", q.Len())
+	}
+	for i, w := range want {
+		if task := q.Poll(); task == nil || task.Url != w {
+			t.Fatalf("poll %d = %v, want %s", i, task, w)
+		}
+	}
+	if !q.IsEmpty() || q.Poll() != nil {
+		t.Fatal("queue is not empty")
+	}
+}
@@ -0,0 +1,43 @@
+package gathertool
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// CanonicalURL url规范化, 用于去重的key
+// scheme与host转小写, 去除默认端口与锚点, 解析 . 与 .., 去除末尾的 /, query参数排序
+// 无法解析的url原样返回
+func CanonicalURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+	u.Fragment = ""
+
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	p = path.Clean(p)
+	if p == "." {
+		p = "/"
+	}
+	if u.Host != "" && !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	u.RawPath = p
+	if unescaped, err := url.PathUnescape(p); err == nil {
+		u.Path = unescaped
+	}
+
+	// Encode 按key排序
+	u.RawQuery = u.Query().Encode()
+	return u.String()
+}
@@ -0,0 +1,28 @@
+package gathertool
+
+import (
+	"testing"
+)
+
+func TestCanonicalURL(t *testing.T) {
+	cases := []struct {
+		raw  string
+		want string
+	}{
+		{"http://host/a", "http://host/a"},
+		{"http://host/a/", "http://host/a"},
+		{"HTTP://Host:80/a", "http://host/a"},
+		{"https://host:443/a#top", "https://host/a"},
+		{"http://host:8080/a", "http://host:8080/a"},
+		{"http://host/a?b=1&c=2", "http://host/a?b=1&c=2"},
+		{"http://host/a?c=2&b=1", "http://host/a?b=1&c=2"},
+		{"http://host/x/../a/./", "http://host/a"},
+		{"http://host", "http://host/"},
+		{"http://host/a%20b/", "http://host/a%20b"},
+	}
+	for _, v := range cases {
+		if got := CanonicalURL(v.raw); got != v.want {
+			t.Errorf("CanonicalURL(%q) = %q, want %q", v.raw, got, v.want)
+		}
+	}
+}